@@ -1,9 +1,85 @@
 package config
 
+import "time"
+
 const (
-	ListenAddr  = "0.0.0.0:9090"
-	Kubeconfigs = `{"TST-1":"config/opsconfig","TST-2":"config/opsconfig"}`
+	ListenAddr = "0.0.0.0:9090"
+
+	// ClusterConfigPath 集群注册表的默认路径
+	// 可以是 json 文件，内容为 {"集群名":"kubeconfig路径"}
+	// 也可以是目录，目录下每个文件为一个 kubeconfig，文件名（去掉扩展名）即集群名
+	ClusterConfigPath = "config/clusters.json"
+	// ClusterConfigPathEnv 用于覆盖 ClusterConfigPath 的环境变量
+	ClusterConfigPathEnv = "K8S_CLUSTERS_PATH"
+	// ClusterKubeconfigEnvPrefix 以该前缀开头的环境变量用于新增或覆盖单个集群
+	// 如 K8S_KUBECONFIG_TST-3=/etc/kubeadm/tst3.conf
+	ClusterKubeconfigEnvPrefix = "K8S_KUBECONFIG_"
+	// ClusterProbeTimeout 集群健康检查时单个集群的超时时间
+	ClusterProbeTimeout = 5 * time.Second
+
+	// InformerCacheEnabled 列表和详情接口是否优先从 informer 本地缓存读取，请求中可用 no_cache=true 跳过缓存
+	InformerCacheEnabled = true
+	// InformerResync informer 的全量 resync 周期
+	InformerResync = 10 * time.Minute
+	// InformerSyncTimeout 等待 informer 首次同步的超时时间，超时后回退到直接访问 apiserver
+	InformerSyncTimeout = 10 * time.Second
+	// InformerFailureBackoff informer 同步失败后，该时间内同一资源直接访问 apiserver，不再重新创建 informer
+	InformerFailureBackoff = time.Minute
+	// InformerIdleTimeout informer 超过该时间没有被访问则停止，释放 watch 连接和内存
+	InformerIdleTimeout = 30 * time.Minute
+
+	// CursorPageLimit 游标分页未指定 limit 时每页的数量
+	CursorPageLimit = 100
+	// CursorPageMaxLimit 游标分页每页的最大数量
+	CursorPageMaxLimit = 1000
+
+	// ExecIdleTimeout exec 会话超过该时间没有收到客户端输入则断开
+	ExecIdleTimeout = 10 * time.Minute
+	// ExecRecordDir exec 会话录像的保存目录，录像为 asciinema v2 格式，为空时不录像
+	ExecRecordDir = "records/exec"
+
+	// PodFileMaxDownloadBytes 从容器下载文件时打包后的最大字节数，超出时中断下载
+	PodFileMaxDownloadBytes = 1 << 30
+	// PodFileMaxUploadBytes 上传到容器的单个文件的最大字节数
+	PodFileMaxUploadBytes = 100 << 20
+
+	// RolloutStatusTimeout 等待发布完成未指定超时时间时的默认值
+	RolloutStatusTimeout = 10 * time.Minute
+	// RolloutStatusMaxTimeout 等待发布完成的最长时间
+	RolloutStatusMaxTimeout = time.Hour
+
+	// DebugImage 临时调试容器未指定镜像时使用的镜像
+	DebugImage = "busybox:1.36"
+	// DebugContainerReadyTimeout 等待临时调试容器运行的超时时间
+	DebugContainerReadyTimeout = 60 * time.Second
+
+	// PortForwardSessionTTL 端口转发会话未指定有效期时的默认有效期，到期后自动关闭
+	PortForwardSessionTTL = 30 * time.Minute
+	// PortForwardMaxSessionTTL 端口转发会话的最长有效期
+	PortForwardMaxSessionTTL = 4 * time.Hour
+	// PortForwardMaxSessions 同时存在的端口转发会话数上限
+	PortForwardMaxSessions = 50
+	// PortForwardReadyTimeout 建立端口转发的超时时间
+	PortForwardReadyTimeout = 10 * time.Second
 
 	// PodLogTailLine 查看容器日志时，显示的 tail 行数 tail -n 5000
 	PodLogTailLine = 5000
+	// PodLogMaxBytes 查看容器日志时单次返回的最大字节数，超出部分截断，防止日志量大的容器占满内存
+	PodLogMaxBytes = 10 << 20
+	// PodLogMaxReadBytes 查看容器日志时最多从 apiserver 读取的字节数，tail_lines 为 -1 时避免读取全部日志
+	PodLogMaxReadBytes = 64 << 20
+	// PodLogMaxLineBytes 逐行读取容器日志时单行的最大字节数，超出部分丢弃，防止没有换行的输出占满内存
+	PodLogMaxLineBytes = 64 << 10
+	// PodLogSearchMaxContext 搜索容器日志时，匹配行前后最多返回的上下文行数
+	PodLogSearchMaxContext = 100
+	// PodLogFollowTailLine 实时查看容器日志时，未指定 tail_lines 时先返回的行数
+	PodLogFollowTailLine = 100
+	// DeploymentLogConcurrency 聚合 Deployment 日志时同时获取日志的容器数
+	DeploymentLogConcurrency = 10
+	// DeploymentLogFlushInterval 实时聚合 Deployment 日志时，每隔该时间将收到的日志按时间戳排序后推送
+	DeploymentLogFlushInterval = 500 * time.Millisecond
 )
+
+// WebSocketAllowedOrigins 允许建立 websocket 连接的跨域来源，如 https://console.example.com
+// 与请求 Host 同源以及不带 Origin 头的非浏览器请求始终允许，其余来源拒绝，防止跨站劫持 exec、端口转发等连接
+var WebSocketAllowedOrigins = []string{}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
+
+	"kubeadm-platform/service"
+)
+
+var Cluster cluster
+
+type cluster struct{}
+
+// GetClusters 获取集群列表，默认返回最近一次探测的健康状态，probe=true 时重新探测所有集群
+func (c *cluster) GetClusters(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		Probe bool `form:"probe"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	data := service.K8s.CachedClusterHealth()
+	if params.Probe {
+		data = service.K8s.ProbeClusters()
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取集群列表成功",
+		"data": data,
+	})
+}
+
+// GetClusterHealth 获取单个集群的健康状态
+func (c *cluster) GetClusterHealth(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		Cluster string `form:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.K8s.ProbeCluster(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取集群健康状态成功",
+		"data": data,
+	})
+}
+
+// AddCluster 注册集群
+func (c *cluster) AddCluster(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		Cluster    string `json:"cluster"`
+		Kubeconfig string `json:"kubeconfig"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	if err := service.K8s.AddCluster(params.Cluster, params.Kubeconfig); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "注册集群成功",
+		"data": nil,
+	})
+}
+
+// UpdateCluster 更新集群的 kubeconfig
+func (c *cluster) UpdateCluster(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		Cluster    string `json:"cluster"`
+		Kubeconfig string `json:"kubeconfig"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	if err := service.K8s.UpdateCluster(params.Cluster, params.Kubeconfig); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "更新集群成功",
+		"data": nil,
+	})
+}
+
+// DeleteCluster 移除集群
+func (c *cluster) DeleteCluster(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		Cluster string `json:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	if err := service.K8s.RemoveCluster(params.Cluster); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "移除集群成功",
+		"data": nil,
+	})
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
+
+	"kubeadm-platform/service"
+)
+
+var DaemonSet daemonSet
+
+type daemonSet struct{}
+
+// RestartDaemonSet 重启 daemonset
+func (d *daemonSet) RestartDaemonSet(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		DaemonSetName string `json:"daemonset_name"`
+		Namespace     string `json:"namespace"`
+		Cluster       string `json:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.DaemonSet.RestartDaemonSet(client, params.DaemonSetName, params.Namespace)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "重启DaemonSet成功",
+		"data": nil,
+	})
+}
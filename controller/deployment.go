@@ -1,8 +1,10 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wonderivan/logger"
@@ -18,11 +20,24 @@ type deployment struct{}
 func (d *deployment) GetDeployments(ctx *gin.Context) {
 	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Namespace  string `form:"namespace"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
-		Cluster    string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		Namespaces    string `form:"namespaces"`
+		Status        string `form:"status"`
+		Image         string `form:"image"`
+		Regex         bool   `form:"regex"`
+		IgnoreCase    bool   `form:"ignore_case"`
+		SortBy        string `form:"sort_by"`
+		Namespace     string `form:"namespace"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		// 为 cursor 时使用 apiserver 游标分页，配合 cursor 参数翻页
+		Paginate string `form:"paginate"`
+		Cursor   string `form:"cursor"`
+		// 为 true 时跳过 informer 缓存，直接访问 apiserver
+		NoCache bool `form:"no_cache"`
 	})
 	// 绑定参数
 	// form格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
@@ -44,7 +59,26 @@ func (d *deployment) GetDeployments(ctx *gin.Context) {
 		return
 	}
 	// 调用 service 方法，获取列表
-	data, err := service.Deployment.GetDeployments(client, params.FilterName, params.Namespace, params.Limit, params.Page)
+	query := &service.DataSelectorQuery{
+		FilterQuery: &service.FilterQuery{
+			Name:          params.FilterName,
+			LabelSelector: params.LabelSelector,
+			FieldSelector: params.FieldSelector,
+			Namespaces:    params.Namespaces,
+			Status:        params.Status,
+			Image:         params.Image,
+			Regex:         params.Regex,
+			IgnoreCase:    params.IgnoreCase,
+		},
+		SortQuery: &service.SortQuery{SortBy: params.SortBy},
+		PaginateQuery: &service.PaginateQuery{
+			Limit:      params.Limit,
+			Page:       params.Page,
+			CursorMode: params.Paginate == "cursor",
+			Cursor:     params.Cursor,
+		},
+	}
+	data, err := service.Deployment.GetDeployments(client, params.Namespace, query, !params.NoCache)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -65,6 +99,8 @@ func (d *deployment) GetDeploymentDetail(ctx *gin.Context) {
 		DeploymentName string `form:"deployment_name"`
 		Namespace      string `form:"namespace"`
 		Cluster        string `form:"cluster"`
+		// 为 true 时跳过 informer 缓存，直接访问 apiserver
+		NoCache bool `form:"no_cache"`
 	})
 	// 绑定参数
 	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
@@ -86,7 +122,7 @@ func (d *deployment) GetDeploymentDetail(ctx *gin.Context) {
 		return
 	}
 	// 调用 service 方法，获取列表
-	data, err := service.Deployment.GetDeploymentDetail(client, params.DeploymentName, params.Namespace)
+	data, status, err := service.Deployment.GetDeploymentDetail(client, params.DeploymentName, params.Namespace, !params.NoCache)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -95,8 +131,90 @@ func (d *deployment) GetDeploymentDetail(ctx *gin.Context) {
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{
-		"msg":  "获取Deployment详情成功",
-		"data": data,
+		"msg":   "获取Deployment详情成功",
+		"data":  data,
+		"cache": status,
+		// 发布是否已暂停
+		"paused": data.Spec.Paused,
+	})
+}
+
+// GetDeploymentLog 聚合 deployment 下所有 pod 的容器日志，按时间戳合并，每行以 [pod/container] 开头
+// follow 为 true 时实时推送，传输方式与 /api/k8s/pod/log/stream 相同
+func (d *deployment) GetDeploymentLog(ctx *gin.Context) {
+	//接收参数,匿名结构体，get请求为form格式，其他请求为json格式
+	params := new(struct {
+		DeploymentName string `form:"deployment_name"`
+		Namespace      string `form:"namespace"`
+		// 为空时获取所有容器的日志
+		ContainerName string `form:"container_name"`
+		Previous      bool   `form:"previous"`
+		SinceSeconds  int64  `form:"since_seconds"`
+		SinceTime     string `form:"since_time"`
+		TailLines     int64  `form:"tail_lines"`
+		Timestamps    bool   `form:"timestamps"`
+		LimitBytes    int64  `form:"limit_bytes"`
+		Follow        bool   `form:"follow"`
+		Cluster       string `form:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	query := &service.PodLogQuery{
+		ContainerName: params.ContainerName,
+		Previous:      params.Previous,
+		SinceSeconds:  params.SinceSeconds,
+		SinceTime:     params.SinceTime,
+		TailLines:     params.TailLines,
+		Timestamps:    params.Timestamps,
+		LimitBytes:    params.LimitBytes,
+	}
+	if !params.Follow {
+		data, err := service.Deployment.GetDeploymentLog(client, params.DeploymentName, params.Namespace, query)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"msg":  err.Error(),
+				"data": nil,
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"msg":  "获取Deployment日志成功",
+			"data": data,
+		})
+		return
+	}
+
+	// 先找到所有容器，失败时仍以 json 返回
+	sources, err := service.Deployment.GetLogSources(client, params.DeploymentName, params.Namespace, params.ContainerName)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	// 客户端断开时取消所有上游日志流
+	logCtx, cancel := context.WithCancel(ctx.Request.Context())
+	defer cancel()
+	streamLines(ctx, logCtx, cancel, func(send func(line string) error) error {
+		return service.Deployment.FollowDeploymentLog(logCtx, client, params.Namespace, sources, query, send)
 	})
 }
 
@@ -269,6 +387,155 @@ func (d *deployment) RestartDeployment(ctx *gin.Context) {
 	})
 }
 
+// SetDeploymentImage 更新 deployment 中指定容器的镜像
+// wait=true 时等待发布完成后返回发布进度，失败或超时返回 500
+func (d *deployment) SetDeploymentImage(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		DeploymentName string `json:"deployment_name"`
+		Namespace      string `json:"namespace"`
+		// 容器名 -> 镜像
+		Images      map[string]string `json:"images"`
+		ChangeCause string            `json:"change_cause"`
+		Wait        bool              `json:"wait"`
+		// 为 0 时使用默认超时时间
+		TimeoutSeconds int    `json:"timeout_seconds"`
+		Cluster        string `json:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.Deployment.SetImage(client, params.DeploymentName, params.Namespace, params.Images, params.ChangeCause)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if !params.Wait {
+		ctx.JSON(http.StatusOK, gin.H{
+			"msg":  "更新Deployment镜像成功",
+			"data": nil,
+		})
+		return
+	}
+	// 镜像变化后 generation 递增，controller 处理新版本前不会因上一次发布遗留的 condition 判定失败
+	timeout := time.Duration(params.TimeoutSeconds) * time.Second
+	data, err := service.Deployment.WatchRolloutStatus(ctx.Request.Context(), client, params.DeploymentName, params.Namespace, timeout, func(status *service.RolloutStatus) error {
+		return nil
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  fmt.Sprintf("更新Deployment镜像成功, %v", err),
+			"data": data,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "更新Deployment镜像成功, " + data.Message,
+		"data": data,
+	})
+}
+
+// PauseDeployment 暂停 deployment 的发布
+func (d *deployment) PauseDeployment(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		DeploymentName string `json:"deployment_name"`
+		Namespace      string `json:"namespace"`
+		Cluster        string `json:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.Deployment.PauseDeployment(client, params.DeploymentName, params.Namespace)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "暂停Deployment成功",
+		"data": nil,
+	})
+}
+
+// ResumeDeployment 恢复 deployment 的发布
+func (d *deployment) ResumeDeployment(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		DeploymentName string `json:"deployment_name"`
+		Namespace      string `json:"namespace"`
+		Cluster        string `json:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.Deployment.ResumeDeployment(client, params.DeploymentName, params.Namespace)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "恢复Deployment成功",
+		"data": nil,
+	})
+}
+
 // CreateDeployment 创建 deployment
 func (d *deployment) CreateDeployment(ctx *gin.Context) {
 	var (
@@ -308,3 +575,221 @@ func (d *deployment) CreateDeployment(ctx *gin.Context) {
 		"data": nil,
 	})
 }
+
+// GetDeploymentRevisions 获取 deployment 的历史版本
+func (d *deployment) GetDeploymentRevisions(ctx *gin.Context) {
+	//接收参数,匿名结构体，get请求为form格式，其他请求为json格式
+	params := new(struct {
+		DeploymentName string `form:"deployment_name"`
+		Namespace      string `form:"namespace"`
+		Cluster        string `form:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Deployment.GetRevisions(client, params.DeploymentName, params.Namespace)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取Deployment历史版本成功",
+		"data": data,
+	})
+}
+
+// DiffDeploymentRevisions 对比 deployment 两个版本的 pod 模板
+func (d *deployment) DiffDeploymentRevisions(ctx *gin.Context) {
+	//接收参数,匿名结构体，get请求为form格式，其他请求为json格式
+	params := new(struct {
+		DeploymentName string `form:"deployment_name"`
+		Namespace      string `form:"namespace"`
+		// to 为空时与当前模板对比
+		From    int64  `form:"from"`
+		To      int64  `form:"to"`
+		Cluster string `form:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Deployment.DiffRevisions(client, params.DeploymentName, params.Namespace, params.From, params.To)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "对比Deployment版本成功",
+		"data": data,
+	})
+}
+
+// RollbackDeployment 回滚 deployment 到指定版本
+func (d *deployment) RollbackDeployment(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		DeploymentName string `json:"deployment_name"`
+		Namespace      string `json:"namespace"`
+		// 为 0 时回滚到上一个版本
+		Revision int64  `json:"revision"`
+		Cluster  string `json:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	rolledBack, err := service.Deployment.RollbackDeployment(client, params.DeploymentName, params.Namespace, params.Revision)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	msg := "回滚Deployment成功"
+	if !rolledBack {
+		msg = "目标版本与当前版本相同，跳过回滚"
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  msg,
+		"data": nil,
+	})
+}
+
+// GetRolloutStatus 获取 deployment 的发布进度
+// 默认通过 SSE 推送 status 事件，发布完成时发送 end 事件，失败或超时时发送 error 事件
+// wait=true 时阻塞到发布完成后以 json 返回，失败或超时返回 500，供 CI 使用
+func (d *deployment) GetRolloutStatus(ctx *gin.Context) {
+	//接收参数,匿名结构体，get请求为form格式，其他请求为json格式
+	params := new(struct {
+		DeploymentName string `form:"deployment_name"`
+		Namespace      string `form:"namespace"`
+		// 为 0 时使用默认超时时间
+		TimeoutSeconds int    `form:"timeout_seconds"`
+		Wait           bool   `form:"wait"`
+		Cluster        string `form:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	timeout := time.Duration(params.TimeoutSeconds) * time.Second
+	// 客户端断开时停止监听
+	watchCtx := ctx.Request.Context()
+
+	if params.Wait {
+		data, err := service.Deployment.WatchRolloutStatus(watchCtx, client, params.DeploymentName, params.Namespace, timeout, func(status *service.RolloutStatus) error {
+			return nil
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"msg":  err.Error(),
+				"data": data,
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"msg":  data.Message,
+			"data": data,
+		})
+		return
+	}
+
+	// 推送第一个事件前出错时仍以 json 返回
+	started := false
+	data, err := service.Deployment.WatchRolloutStatus(watchCtx, client, params.DeploymentName, params.Namespace, timeout, func(status *service.RolloutStatus) error {
+		if !started {
+			started = true
+			// SSE，关闭代理缓冲以便进度及时到达
+			ctx.Header("Cache-Control", "no-cache")
+			ctx.Header("X-Accel-Buffering", "no")
+		}
+		ctx.SSEvent("status", status)
+		ctx.Writer.Flush()
+		return nil
+	})
+	if !started && err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	// 客户端已断开时无需通知
+	if watchCtx.Err() != nil {
+		return
+	}
+	if err != nil {
+		ctx.SSEvent("error", err.Error())
+	} else {
+		ctx.SSEvent("end", data)
+	}
+	ctx.Writer.Flush()
+}
@@ -1,12 +1,17 @@
 package controller
 
 import (
+	"context"
 	"fmt"
+	"mime/multipart"
 	"net/http"
+	"path"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wonderivan/logger"
 
+	"kubeadm-platform/config"
 	"kubeadm-platform/service"
 )
 
@@ -18,11 +23,25 @@ type pod struct{}
 func (p *pod) GetPods(ctx *gin.Context) {
 	// 接收参数,匿名结构体，get请求为form格式，其他请求为json格式
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Namespace  string `form:"namespace"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
-		Cluster    string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		Namespaces    string `form:"namespaces"`
+		Status        string `form:"status"`
+		NodeName      string `form:"node_name"`
+		Image         string `form:"image"`
+		Regex         bool   `form:"regex"`
+		IgnoreCase    bool   `form:"ignore_case"`
+		SortBy        string `form:"sort_by"`
+		Namespace     string `form:"namespace"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		// 为 cursor 时使用 apiserver 游标分页，配合 cursor 参数翻页
+		Paginate string `form:"paginate"`
+		Cursor   string `form:"cursor"`
+		// 为 true 时跳过 informer 缓存，直接访问 apiserver
+		NoCache bool `form:"no_cache"`
 	})
 	// 绑定参数
 	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
@@ -44,7 +63,27 @@ func (p *pod) GetPods(ctx *gin.Context) {
 		return
 	}
 	// 调用 service 方法，获取列表
-	data, err := service.Pod.GetPods(client, params.FilterName, params.Namespace, params.Limit, params.Page)
+	query := &service.DataSelectorQuery{
+		FilterQuery: &service.FilterQuery{
+			Name:          params.FilterName,
+			LabelSelector: params.LabelSelector,
+			FieldSelector: params.FieldSelector,
+			Namespaces:    params.Namespaces,
+			Status:        params.Status,
+			NodeName:      params.NodeName,
+			Image:         params.Image,
+			Regex:         params.Regex,
+			IgnoreCase:    params.IgnoreCase,
+		},
+		SortQuery: &service.SortQuery{SortBy: params.SortBy},
+		PaginateQuery: &service.PaginateQuery{
+			Limit:      params.Limit,
+			Page:       params.Page,
+			CursorMode: params.Paginate == "cursor",
+			Cursor:     params.Cursor,
+		},
+	}
+	data, err := service.Pod.GetPods(client, params.Namespace, query, !params.NoCache)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -66,6 +105,8 @@ func (p *pod) GetPodDetail(ctx *gin.Context) {
 		PodName   string `form:"pod_name"`
 		Namespace string `form:"namespace"`
 		Cluster   string `form:"cluster"`
+		// 为 true 时跳过 informer 缓存，直接访问 apiserver
+		NoCache bool `form:"no_cache"`
 	})
 	// 绑定参数
 	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
@@ -87,7 +128,7 @@ func (p *pod) GetPodDetail(ctx *gin.Context) {
 		return
 	}
 	//调用 service 方法，获取列表
-	data, err := service.Pod.GetPodDetail(client, params.PodName, params.Namespace)
+	data, status, err := service.Pod.GetPodDetail(client, params.PodName, params.Namespace, !params.NoCache)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -97,8 +138,9 @@ func (p *pod) GetPodDetail(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"msg":  "获取Pod详情成功",
-		"data": data,
+		"msg":   "获取Pod详情成功",
+		"data":  data,
+		"cache": status,
 	})
 }
 
@@ -229,13 +271,29 @@ func (p *pod) GetPodContainer(ctx *gin.Context) {
 }
 
 // GetPodLog 获取pod容器日志
+// 传入 pattern 时只返回匹配的行及其上下文；download 为 true 时以 gzip 附件下载完整日志
 func (p *pod) GetPodLog(ctx *gin.Context) {
 	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
 	params := new(struct {
 		ContainerName string `form:"container_name"`
 		PodName       string `form:"pod_name"`
 		Namespace     string `form:"namespace"`
-		Cluster       string `form:"cluster"`
+		// 为 true 时获取上一次退出的容器日志
+		Previous bool `form:"previous"`
+		// since_seconds 和 since_time 只能指定一个，since_time 为 RFC3339 格式
+		SinceSeconds int64  `form:"since_seconds"`
+		SinceTime    string `form:"since_time"`
+		// 为 -1 时不限制行数
+		TailLines  int64 `form:"tail_lines"`
+		Timestamps bool  `form:"timestamps"`
+		LimitBytes int64 `form:"limit_bytes"`
+		// 搜索条件，regex 为 true 时 pattern 为正则表达式，context 为匹配行前后的行数
+		Pattern    string `form:"pattern"`
+		Regex      bool   `form:"regex"`
+		IgnoreCase bool   `form:"ignore_case"`
+		Context    int    `form:"context"`
+		Download   bool   `form:"download"`
+		Cluster    string `form:"cluster"`
 	})
 	// 绑定参数
 	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
@@ -256,8 +314,56 @@ func (p *pod) GetPodLog(ctx *gin.Context) {
 		})
 		return
 	}
-	// 调用 service 方法，获取列表
-	data, err := service.Pod.GetPodLog(client, params.ContainerName, params.PodName, params.Namespace)
+	// 调用 service 方法，获取日志
+	query := &service.PodLogQuery{
+		ContainerName: params.ContainerName,
+		Previous:      params.Previous,
+		SinceSeconds:  params.SinceSeconds,
+		SinceTime:     params.SinceTime,
+		TailLines:     params.TailLines,
+		Timestamps:    params.Timestamps,
+		LimitBytes:    params.LimitBytes,
+	}
+	if params.Download {
+		// 先打开日志流，失败时仍以 json 返回
+		stream, err := service.Pod.DownloadPodLog(ctx.Request.Context(), client, params.PodName, params.Namespace, query)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"msg":  err.Error(),
+				"data": nil,
+			})
+			return
+		}
+		defer stream.Close()
+		filename := fmt.Sprintf("%s_%s_%s.log.gz", params.PodName, params.ContainerName, time.Now().Format("20060102150405"))
+		ctx.Header("Content-Type", "application/gzip")
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		ctx.Status(http.StatusOK)
+		// 响应头已发送，出错时只能中断下载
+		_ = service.Pod.WriteLogGzip(ctx.Writer, stream)
+		return
+	}
+	if params.Pattern != "" {
+		data, err := service.Pod.SearchPodLog(client, params.PodName, params.Namespace, query, &service.LogSearch{
+			Pattern:    params.Pattern,
+			Regex:      params.Regex,
+			IgnoreCase: params.IgnoreCase,
+			Context:    params.Context,
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"msg":  err.Error(),
+				"data": nil,
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"msg":  "搜索Pod容器日志成功",
+			"data": data,
+		})
+		return
+	}
+	data, truncated, err := service.Pod.GetPodLog(client, params.PodName, params.Namespace, query)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -266,7 +372,495 @@ func (p *pod) GetPodLog(ctx *gin.Context) {
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{
-		"msg":  "获取Pod容器日志成功",
-		"data": data,
+		"msg":       "获取Pod容器日志成功",
+		"data":      data,
+		"truncated": truncated,
+	})
+}
+
+// StreamPodLog 实时推送容器日志
+// 请求带有 websocket 升级头时使用 websocket，每行日志为一条文本消息；否则使用 SSE，每行日志为一个 log 事件
+func (p *pod) StreamPodLog(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		ContainerName string `form:"container_name"`
+		PodName       string `form:"pod_name"`
+		Namespace     string `form:"namespace"`
+		// 为 true 时获取上一次退出的容器日志
+		Previous bool `form:"previous"`
+		// since_seconds 和 since_time 只能指定一个，since_time 为 RFC3339 格式
+		SinceSeconds int64  `form:"since_seconds"`
+		SinceTime    string `form:"since_time"`
+		// 为 -1 时不限制行数
+		TailLines  int64  `form:"tail_lines"`
+		Timestamps bool   `form:"timestamps"`
+		LimitBytes int64  `form:"limit_bytes"`
+		Cluster    string `form:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	// 客户端断开时取消上游日志流
+	logCtx, cancel := context.WithCancel(ctx.Request.Context())
+	defer cancel()
+	// 先打开日志流，失败时仍以 json 返回
+	query := &service.PodLogQuery{
+		ContainerName: params.ContainerName,
+		Previous:      params.Previous,
+		SinceSeconds:  params.SinceSeconds,
+		SinceTime:     params.SinceTime,
+		TailLines:     params.TailLines,
+		Timestamps:    params.Timestamps,
+		LimitBytes:    params.LimitBytes,
+	}
+	stream, err := service.Pod.FollowPodLog(logCtx, client, params.PodName, params.Namespace, query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	defer stream.Close()
+	streamLines(ctx, logCtx, cancel, func(send func(line string) error) error {
+		return service.Pod.StreamLogLines(logCtx, stream, send)
+	})
+}
+
+// ExecPod 通过 websocket 在容器中执行命令或打开 shell
+func (p *pod) ExecPod(ctx *gin.Context) {
+	// 接收参数,匿名结构体，websocket 握手为 get 请求，使用 form 格式
+	params := new(struct {
+		PodName       string `form:"pod_name"`
+		ContainerName string `form:"container_name"`
+		Namespace     string `form:"namespace"`
+		// 可重复传入，如 command=ls&command=-l，为空时打开 shell
+		Command []string `form:"command"`
+		TTY     bool     `form:"tty"`
+		Cols    uint16   `form:"cols"`
+		Rows    uint16   `form:"rows"`
+		Cluster string   `form:"cluster"`
+		// attach 到容器主进程，如临时调试容器
+		Attach bool `form:"attach"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client 和 rest 配置
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	conf, err := service.K8s.GetRestConfig(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	// 升级 websocket 之前校验参数，错误仍以 json 返回
+	opts := &service.ExecOptions{
+		Cluster:       params.Cluster,
+		Namespace:     params.Namespace,
+		PodName:       params.PodName,
+		ContainerName: params.ContainerName,
+		Command:       params.Command,
+		TTY:           params.TTY,
+		Cols:          params.Cols,
+		Rows:          params.Rows,
+		Attach:        params.Attach,
+	}
+	if err := service.Terminal.Validate(client, opts); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已向客户端返回错误
+		logger.Error(fmt.Sprintf("升级websocket失败, %v", err))
+		return
+	}
+	// 会话结束原因通过 exit 消息返回给客户端
+	_ = service.Terminal.Run(client, conf, conn, opts)
+}
+
+// DownloadPodFile 将容器中的文件或目录打包为 tar 或 zip 下载
+func (p *pod) DownloadPodFile(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		PodName       string `form:"pod_name"`
+		ContainerName string `form:"container_name"`
+		Namespace     string `form:"namespace"`
+		// 容器中的文件或目录，必须为绝对路径
+		Path string `form:"path"`
+		// tar 或 zip，默认 tar
+		Format  string `form:"format"`
+		Cluster string `form:"cluster"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	if params.Format == "" {
+		params.Format = service.ArchiveTar
+	}
+	// 获取 client 和 rest 配置
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	conf, err := service.K8s.GetRestConfig(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	opts := &service.PodFileOptions{
+		Namespace:     params.Namespace,
+		PodName:       params.PodName,
+		ContainerName: params.ContainerName,
+		Path:          params.Path,
+	}
+	if err := service.PodFile.Validate(client, opts); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	contentType := "application/x-tar"
+	if params.Format == service.ArchiveZip {
+		contentType = "application/zip"
+	}
+	writer := &attachmentWriter{
+		ctx:         ctx,
+		filename:    fmt.Sprintf("%s.%s", path.Base(opts.Path), params.Format),
+		contentType: contentType,
+	}
+	err = service.PodFile.CopyFromPod(ctx.Request.Context(), client, conf, opts, params.Format, writer)
+	// 已开始下载时只能中断连接
+	if err != nil && !writer.started {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+	}
+}
+
+// UploadPodFile 上传文件到容器的指定目录，使用 multipart/form-data
+func (p *pod) UploadPodFile(ctx *gin.Context) {
+	// 限制请求体大小，multipart 的其他字段预留 1MB
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, config.PodFileMaxUploadBytes+1<<20)
+	// 接收参数,匿名结构体，上传文件使用 multipart 表单
+	params := new(struct {
+		PodName       string `form:"pod_name"`
+		ContainerName string `form:"container_name"`
+		Namespace     string `form:"namespace"`
+		// 容器中的目标目录，必须为绝对路径
+		Path    string                `form:"path"`
+		File    *multipart.FileHeader `form:"file"`
+		Cluster string                `form:"cluster"`
+	})
+	// 绑定参数
+	if err := ctx.ShouldBind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	if params.File == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  "绑定参数失败, 缺少上传文件",
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client 和 rest 配置
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	conf, err := service.K8s.GetRestConfig(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	opts := &service.PodFileOptions{
+		Namespace:     params.Namespace,
+		PodName:       params.PodName,
+		ContainerName: params.ContainerName,
+		Path:          params.Path,
+	}
+	if err := service.PodFile.Validate(client, opts); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	file, err := params.File.Open()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  fmt.Sprintf("读取上传文件失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	defer file.Close()
+	err = service.PodFile.CopyToPod(ctx.Request.Context(), client, conf, opts, params.File.Filename, params.File.Size, file)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "上传文件成功",
+		"data": path.Join(opts.Path, path.Base(params.File.Filename)),
+	})
+}
+
+// CreateDebugContainer 向 pod 添加临时调试容器
+// 返回的容器名可用于 /api/k8s/pod/exec，attach=true&tty=true 时连接调试容器的 shell
+func (p *pod) CreateDebugContainer(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		PodName   string `json:"pod_name"`
+		Namespace string `json:"namespace"`
+		// 调试容器名和镜像，为空时使用默认值
+		ContainerName string `json:"container_name"`
+		Image         string `json:"image"`
+		// 共享进程命名空间的目标容器
+		TargetContainer string   `json:"target_container"`
+		Command         []string `json:"command"`
+		Cluster         string   `json:"cluster"`
+	})
+	// 绑定参数
+	// form格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	//获取client
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	containerName, err := service.PodDebug.CreateDebugContainer(client, &service.DebugOptions{
+		Namespace:       params.Namespace,
+		PodName:         params.PodName,
+		Name:            params.ContainerName,
+		Image:           params.Image,
+		TargetContainer: params.TargetContainer,
+		Command:         params.Command,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "添加调试容器成功",
+		"data": containerName,
+	})
+}
+
+// CreatePortForward 创建到 pod 端口的转发会话
+// 返回的会话 ID 用于 websocket 隧道 /api/k8s/pod/portforward/tunnel 和 http 代理 /api/k8s/pod/portforward/proxy/:id/
+func (p *pod) CreatePortForward(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		PodName   string `json:"pod_name"`
+		Namespace string `json:"namespace"`
+		Port      int    `json:"port"`
+		// 会话有效期，为 0 时使用默认值
+		TTLSeconds int    `json:"ttl_seconds"`
+		Cluster    string `json:"cluster"`
+	})
+	// 绑定参数
+	// form格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 获取 client 和 rest 配置
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	conf, err := service.K8s.GetRestConfig(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	session, err := service.PortForward.Create(client, conf, params.Cluster, params.Namespace, params.PodName, params.Port, time.Duration(params.TTLSeconds)*time.Second)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "创建端口转发成功",
+		"data": session,
+	})
+}
+
+// GetPortForwards 获取端口转发会话列表
+func (p *pod) GetPortForwards(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取端口转发列表成功",
+		"data": service.PortForward.List(),
+	})
+}
+
+// DeletePortForward 关闭端口转发会话
+func (p *pod) DeletePortForward(ctx *gin.Context) {
+	// 接收参数,匿名结构体，get 请求为 form 格式，其他请求为 json 格式
+	params := new(struct {
+		ID string `json:"id"`
+	})
+	// 绑定参数
+	// form格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	if err := service.PortForward.Delete(params.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "关闭端口转发成功",
+		"data": nil,
 	})
 }
+
+// PortForwardTunnel 通过 websocket 隧道访问转发的端口，消息为二进制格式的 TCP 数据
+// 每个 websocket 连接对应一条到 pod 端口的 TCP 连接
+func (p *pod) PortForwardTunnel(ctx *gin.Context) {
+	// 接收参数,匿名结构体，websocket 握手为 get 请求，使用 form 格式
+	params := new(struct {
+		ID string `form:"id"`
+	})
+	// 绑定参数
+	// form 格式使用 ctx.Bind 方法，json 格式使用 ctx.ShouldBindJSON 方法
+	if err := ctx.Bind(params); err != nil {
+		logger.Error(fmt.Sprintf("绑定参数失败, %v", err))
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  fmt.Sprintf("绑定参数失败, %v", err),
+			"data": nil,
+		})
+		return
+	}
+	// 升级 websocket 之前检查会话，错误仍以 json 返回
+	if !service.PortForward.Exists(params.ID) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  fmt.Sprintf("端口转发会话:%s不存在或已过期", params.ID),
+			"data": nil,
+		})
+		return
+	}
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已向客户端返回错误
+		logger.Error(fmt.Sprintf("升级websocket失败, %v", err))
+		return
+	}
+	if err := service.PortForward.Tunnel(params.ID, conn); err != nil {
+		_ = conn.Close()
+	}
+}
+
+// ProxyPortForward 将 http 请求代理到转发的端口，路径中 :id 之后的部分作为请求 pod 的路径
+func (p *pod) ProxyPortForward(ctx *gin.Context) {
+	err := service.PortForward.Proxy(ctx.Param("id"), ctx.Param("path"), ctx.Writer, ctx.Request)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+	}
+}
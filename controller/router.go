@@ -26,6 +26,12 @@ func (r *router) InitApiRouter(ctx *gin.Engine) {
 				"success": true,
 			})
 		}).
+		// 集群操作
+		GET("/api/k8s/clusters", Cluster.GetClusters).
+		GET("/api/k8s/cluster/health", Cluster.GetClusterHealth).
+		POST("/api/k8s/cluster/add", Cluster.AddCluster).
+		PUT("/api/k8s/cluster/update", Cluster.UpdateCluster).
+		DELETE("/api/k8s/cluster/del", Cluster.DeleteCluster).
 		// pod 操作
 		GET("/api/k8s/pods", Pod.GetPods).
 		GET("/api/k8s/pod/detail", Pod.GetPodDetail).
@@ -33,12 +39,34 @@ func (r *router) InitApiRouter(ctx *gin.Engine) {
 		PUT("/api/k8s/pod/update", Pod.UpdatePod).
 		GET("/api/k8s/pod/container", Pod.GetPodContainer).
 		GET("/api/k8s/pod/log", Pod.GetPodLog).
+		GET("/api/k8s/pod/log/stream", Pod.StreamPodLog).
+		GET("/api/k8s/pod/exec", Pod.ExecPod).
+		GET("/api/k8s/pod/file/download", Pod.DownloadPodFile).
+		POST("/api/k8s/pod/file/upload", Pod.UploadPodFile).
+		POST("/api/k8s/pod/debug", Pod.CreateDebugContainer).
+		POST("/api/k8s/pod/portforward", Pod.CreatePortForward).
+		GET("/api/k8s/pod/portforwards", Pod.GetPortForwards).
+		DELETE("/api/k8s/pod/portforward/del", Pod.DeletePortForward).
+		GET("/api/k8s/pod/portforward/tunnel", Pod.PortForwardTunnel).
+		Any("/api/k8s/pod/portforward/proxy/:id/*path", Pod.ProxyPortForward).
 		// deployment 操作
 		GET("/api/k8s/deployments", Deployment.GetDeployments).
 		GET("/api/k8s/deployment/detail", Deployment.GetDeploymentDetail).
+		GET("/api/k8s/deployment/log", Deployment.GetDeploymentLog).
+		GET("/api/k8s/deployment/revisions", Deployment.GetDeploymentRevisions).
+		GET("/api/k8s/deployment/revision/diff", Deployment.DiffDeploymentRevisions).
+		PUT("/api/k8s/deployment/rollback", Deployment.RollbackDeployment).
+		GET("/api/k8s/deployment/rollout/status", Deployment.GetRolloutStatus).
 		DELETE("/api/k8s/deployment/del", Deployment.DeleteDeployment).
 		PUT("/api/k8s/deployment/update", Deployment.UpdateDeployment).
 		PUT("/api/k8s/deployment/scale", Deployment.ScaleDeployment).
 		PUT("/api/k8s/deployment/restart", Deployment.RestartDeployment).
-		POST("/api/k8s/deployment/create", Deployment.CreateDeployment)
+		PUT("/api/k8s/deployment/image", Deployment.SetDeploymentImage).
+		PUT("/api/k8s/deployment/pause", Deployment.PauseDeployment).
+		PUT("/api/k8s/deployment/resume", Deployment.ResumeDeployment).
+		POST("/api/k8s/deployment/create", Deployment.CreateDeployment).
+		// statefulset 操作
+		PUT("/api/k8s/statefulset/restart", StatefulSet.RestartStatefulSet).
+		// daemonset 操作
+		PUT("/api/k8s/daemonset/restart", DaemonSet.RestartDaemonSet)
 }
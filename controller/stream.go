@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/wonderivan/logger"
+
+	"kubeadm-platform/config"
+)
+
+// upgrader 将 http 请求升级为 websocket，只允许同源或 config.WebSocketAllowedOrigins 中的来源
+var upgrader = websocket.Upgrader{
+	CheckOrigin: checkOrigin,
+}
+
+// checkOrigin 校验 websocket 请求的 Origin，不带 Origin 的请求来自非浏览器客户端，不存在跨站问题
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range config.WebSocketAllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	logger.Warn(fmt.Sprintf("拒绝来源%s的websocket连接", origin))
+	return false
+}
+
+// streamLines 将 run 产生的日志行实时推送给客户端
+// 请求带有 websocket 升级头时使用 websocket，每行为一条文本消息；否则使用 SSE，每行为一个 log 事件
+// 客户端断开时调用 cancel 取消上游日志流，run 应在 streamCtx 取消后尽快返回
+func streamLines(ctx *gin.Context, streamCtx context.Context, cancel context.CancelFunc, run func(send func(line string) error) error) {
+	if websocket.IsWebSocketUpgrade(ctx.Request) {
+		conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+		if err != nil {
+			// Upgrade 失败时已向客户端返回错误
+			logger.Error(fmt.Sprintf("升级websocket失败, %v", err))
+			return
+		}
+		defer conn.Close()
+		// websocket 只用于下行，持续读取客户端消息以感知断开
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		err = run(func(line string) error {
+			return conn.WriteMessage(websocket.TextMessage, []byte(line))
+		})
+		closeCode, reason := websocket.CloseNormalClosure, "日志流结束"
+		if err != nil {
+			closeCode, reason = websocket.CloseInternalServerErr, "读取日志失败"
+		}
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason), time.Now().Add(time.Second))
+		return
+	}
+
+	// SSE，关闭代理缓冲以便日志及时到达
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+	err := run(func(line string) error {
+		ctx.SSEvent("log", line)
+		ctx.Writer.Flush()
+		return nil
+	})
+	// 客户端已断开时无需通知
+	if streamCtx.Err() != nil {
+		return
+	}
+	if err != nil {
+		ctx.SSEvent("error", err.Error())
+	} else {
+		ctx.SSEvent("end", "日志流结束")
+	}
+	ctx.Writer.Flush()
+}
+
+// attachmentWriter 在第一次写入时才发送附件的响应头
+// 写入前出错时响应尚未开始，仍可以返回 json 错误
+type attachmentWriter struct {
+	ctx         *gin.Context
+	filename    string
+	contentType string
+	started     bool
+}
+
+func (w *attachmentWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.ctx.Header("Content-Type", w.contentType)
+		w.ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", w.filename))
+		w.ctx.Status(http.StatusOK)
+	}
+	return w.ctx.Writer.Write(p)
+}
@@ -34,7 +34,7 @@ func main() {
 	}()
 	//优雅关闭server
 	//声明一个系统信号的channel，并监听他，如果没有信号，就一直阻塞，如果有，就继续执行
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 	//设置ctx超时时间
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wonderivan/logger"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"kubeadm-platform/config"
+)
+
+// Cache 按集群、资源类型、命名空间懒加载的 informer 缓存
+var Cache resourceCache
+
+const (
+	cacheResourcePods        = "pods"
+	cacheResourceDeployments = "deployments"
+
+	// CacheSourceInformer 数据来自 informer 本地缓存
+	CacheSourceInformer = "cache"
+	// CacheSourceAPIServer 数据直接来自 apiserver
+	CacheSourceAPIServer = "apiserver"
+)
+
+// CacheStatus 定义返回数据的新鲜度
+type CacheStatus struct {
+	// Source 数据来源，cache 或 apiserver
+	Source string `json:"source"`
+	// SyncedAt informer 完成首次同步的时间
+	SyncedAt *time.Time `json:"synced_at,omitempty"`
+	// LastEventAt 最近一次收到 watch 事件的时间，为空表示同步后没有变化
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+	// ResourceVersion informer 最近一次同步的 resourceVersion
+	ResourceVersion string `json:"resource_version,omitempty"`
+}
+
+// apiServerStatus 直接访问 apiserver 时返回的新鲜度
+var apiServerStatus = &CacheStatus{Source: CacheSourceAPIServer}
+
+// cacheResource 定义一种可缓存的资源
+type cacheResource struct {
+	groupResource schema.GroupResource
+	newInformer   func(client kubernetes.Interface, namespace string) cache.SharedIndexInformer
+}
+
+var cacheResources = map[string]cacheResource{
+	cacheResourcePods: {
+		groupResource: corev1.Resource("pods"),
+		newInformer: func(client kubernetes.Interface, namespace string) cache.SharedIndexInformer {
+			return coreinformers.NewPodInformer(client, namespace, config.InformerResync,
+				cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		},
+	},
+	cacheResourceDeployments: {
+		groupResource: appsv1.Resource("deployments"),
+		newInformer: func(client kubernetes.Interface, namespace string) cache.SharedIndexInformer {
+			return appsinformers.NewDeploymentInformer(client, namespace, config.InformerResync,
+				cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		},
+	},
+}
+
+// cacheKey 每个集群 client 的每种资源、每个命名空间对应一个 informer，命名空间为空表示所有命名空间
+type cacheKey struct {
+	client    kubernetes.Interface
+	resource  string
+	namespace string
+}
+
+type resourceCache struct {
+	// 等待 informer 首次同步的超时时间，为 0 时使用 config.InformerSyncTimeout
+	SyncTimeout time.Duration
+
+	mu        sync.Mutex
+	informers map[cacheKey]*cachedInformer
+	// 同步失败的 informer 在该时间前不再创建，如没有 list/watch 权限
+	failedUntil map[cacheKey]time.Time
+	janitorRun  sync.Once
+}
+
+type cachedInformer struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	// 首次同步完成或失败后关闭
+	ready       chan struct{}
+	syncErr     error
+	syncTimeout time.Duration
+
+	mu         sync.Mutex
+	syncedAt   time.Time
+	lastEvent  time.Time
+	lastAccess time.Time
+}
+
+// List 从缓存中获取资源列表，缓存不可用时返回错误，由调用方回退到 apiserver
+func (c *resourceCache) List(client kubernetes.Interface, resource, namespace string) ([]interface{}, *CacheStatus, error) {
+	ci, err := c.informerFor(client, resource, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 复用所有命名空间的 informer 时按命名空间索引过滤
+	if namespace == "" {
+		return ci.informer.GetStore().List(), ci.status(), nil
+	}
+	items, err := ci.informer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, ci.status(), nil
+}
+
+// Get 从缓存中获取单个资源，不存在时返回与 apiserver 一致的 NotFound 错误
+func (c *resourceCache) Get(client kubernetes.Interface, resource, namespace, name string) (interface{}, *CacheStatus, error) {
+	ci, err := c.informerFor(client, resource, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+	obj, exists, err := ci.informer.GetStore().GetByKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		return nil, ci.status(), apierrors.NewNotFound(cacheResources[resource].groupResource, name)
+	}
+	return obj, ci.status(), nil
+}
+
+// Evict 停止并移除 client 对应的所有 informer，集群移除或 kubeconfig 变更时调用
+func (c *resourceCache) Evict(client kubernetes.Interface) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, ci := range c.informers {
+		if key.client == client {
+			ci.stop()
+			delete(c.informers, key)
+		}
+	}
+	for key := range c.failedUntil {
+		if key.client == client {
+			delete(c.failedUntil, key)
+		}
+	}
+}
+
+// informerFor 获取或懒启动 informer，并等待首次同步完成
+func (c *resourceCache) informerFor(client kubernetes.Interface, resource, namespace string) (*cachedInformer, error) {
+	res, ok := cacheResources[resource]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("资源%s不支持缓存", resource))
+	}
+	c.mu.Lock()
+	if c.informers == nil {
+		c.informers = make(map[cacheKey]*cachedInformer)
+	}
+	// 已有所有命名空间的 informer 时直接复用
+	key := cacheKey{client: client, resource: resource, namespace: ""}
+	ci, ok := c.informers[key]
+	if !ok {
+		key.namespace = namespace
+		ci, ok = c.informers[key]
+	}
+	if !ok {
+		// 最近同步失败过，直接访问 apiserver，避免每个请求都等待同步超时
+		if until, failed := c.failedUntil[key]; failed && time.Now().Before(until) {
+			c.mu.Unlock()
+			return nil, errors.New(fmt.Sprintf("informer %s/%s 同步失败，%s前不使用缓存", resource, namespace, until.Format(time.RFC3339)))
+		}
+		delete(c.failedUntil, key)
+		ci = &cachedInformer{
+			informer:    res.newInformer(client, namespace),
+			stopCh:      make(chan struct{}),
+			ready:       make(chan struct{}),
+			syncTimeout: c.SyncTimeout,
+		}
+		if ci.syncTimeout == 0 {
+			ci.syncTimeout = config.InformerSyncTimeout
+		}
+		c.informers[key] = ci
+		go ci.run()
+	}
+	c.mu.Unlock()
+	c.janitorRun.Do(func() { go c.janitor() })
+
+	<-ci.ready
+	if ci.syncErr != nil {
+		c.mu.Lock()
+		if c.informers[key] == ci {
+			delete(c.informers, key)
+			if c.failedUntil == nil {
+				c.failedUntil = make(map[cacheKey]time.Time)
+			}
+			c.failedUntil[key] = time.Now().Add(config.InformerFailureBackoff)
+		}
+		c.mu.Unlock()
+		return nil, ci.syncErr
+	}
+	ci.mu.Lock()
+	ci.lastAccess = time.Now()
+	ci.mu.Unlock()
+	return ci, nil
+}
+
+// janitor 定期停止空闲的 informer
+func (c *resourceCache) janitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mu.Lock()
+		for key, ci := range c.informers {
+			ci.mu.Lock()
+			idle := !ci.lastAccess.IsZero() && time.Since(ci.lastAccess) > config.InformerIdleTimeout
+			ci.mu.Unlock()
+			if idle {
+				ci.stop()
+				delete(c.informers, key)
+				logger.Info(fmt.Sprintf("informer %s/%s 空闲超时，已停止", key.resource, key.namespace))
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// run 启动 informer 并等待首次同步，超时则停止 informer
+func (ci *cachedInformer) run() {
+	defer close(ci.ready)
+	// 去掉 managedFields，减少缓存占用的内存
+	_ = ci.informer.SetTransform(func(obj interface{}) (interface{}, error) {
+		if accessor, err := meta.Accessor(obj); err == nil {
+			accessor.SetManagedFields(nil)
+		}
+		return obj, nil
+	})
+	_, _ = ci.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { ci.touchEvent() },
+		UpdateFunc: func(oldObj, newObj interface{}) { ci.touchEvent() },
+		DeleteFunc: func(obj interface{}) { ci.touchEvent() },
+	})
+	go ci.informer.Run(ci.stopCh)
+
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(ci.syncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+	syncStop := make(chan struct{})
+	go func() {
+		select {
+		case <-timeout:
+		case <-ci.stopCh:
+		}
+		close(syncStop)
+	}()
+	if !cache.WaitForCacheSync(syncStop, ci.informer.HasSynced) {
+		ci.stop()
+		ci.syncErr = errors.New(fmt.Sprintf("informer同步超时(%s)", ci.syncTimeout))
+		logger.Error(ci.syncErr.Error())
+		return
+	}
+	ci.mu.Lock()
+	ci.syncedAt = time.Now()
+	// 首次同步产生的 add 事件不算作变化
+	ci.lastEvent = time.Time{}
+	ci.mu.Unlock()
+}
+
+func (ci *cachedInformer) stop() {
+	ci.stopOnce.Do(func() { close(ci.stopCh) })
+}
+
+func (ci *cachedInformer) touchEvent() {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	// 首次同步完成前的事件不记录
+	if !ci.syncedAt.IsZero() {
+		ci.lastEvent = time.Now()
+	}
+}
+
+func (ci *cachedInformer) status() *CacheStatus {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	syncedAt := ci.syncedAt
+	status := &CacheStatus{
+		Source:          CacheSourceInformer,
+		SyncedAt:        &syncedAt,
+		ResourceVersion: ci.informer.LastSyncResourceVersion(),
+	}
+	if !ci.lastEvent.IsZero() {
+		lastEvent := ci.lastEvent
+		status.LastEventAt = &lastEvent
+	}
+	return status
+}
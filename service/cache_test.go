@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestResourceCache(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newTestPod("nginx-1", "default", time.Hour),
+		newTestPod("nginx-2", "kube-system", time.Hour),
+		newTestDeployment("web", "default", 1),
+	)
+	c := &resourceCache{}
+	defer c.Evict(client)
+
+	// 懒启动 default 命名空间的 pod informer
+	objs, status, err := c.List(client, cacheResourcePods, "default")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(objs) != 1 || status.Source != CacheSourceInformer || status.SyncedAt == nil {
+		t.Fatalf("List() = %d items, status %+v", len(objs), status)
+	}
+	if status.LastEventAt != nil {
+		t.Errorf("首次同步后 LastEventAt 应为空")
+	}
+
+	// watch 事件更新缓存
+	if _, err := client.CoreV1().Pods("default").Create(context.TODO(), newTestPod("nginx-3", "default", 0), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		objs, status, _ = c.List(client, cacheResourcePods, "default")
+		if len(objs) == 2 && status.LastEventAt != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("缓存未收到新建 pod, items = %d, status %+v", len(objs), status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 详情读取
+	if _, _, err := c.Get(client, cacheResourcePods, "default", "nginx-1"); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if _, _, err := c.Get(client, cacheResourcePods, "default", "missing"); err == nil {
+		t.Errorf("Get() 不存在的 pod 应返回错误")
+	}
+	if _, _, err := c.List(client, "secrets", "default"); err == nil {
+		t.Errorf("List() 不支持的资源应返回错误")
+	}
+
+	// 不同资源类型使用各自的 informer
+	objs, _, err = c.List(client, cacheResourceDeployments, "")
+	if err != nil || len(objs) != 1 {
+		t.Errorf("List(deployments) = %d items, error = %v", len(objs), err)
+	}
+
+	c.Evict(client)
+	if len(c.informers) != 0 {
+		t.Errorf("Evict() 后仍有 %d 个 informer", len(c.informers))
+	}
+}
+
+func TestResourceCacheFailureBackoff(t *testing.T) {
+	client := fake.NewSimpleClientset(newTestPod("nginx-1", "default", time.Hour))
+	lists := 0
+	var mu sync.Mutex
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		lists++
+		mu.Unlock()
+		return true, nil, apierrors.NewForbidden(corev1.Resource("pods"), "", errors.New("rbac"))
+	})
+	c := &resourceCache{SyncTimeout: 200 * time.Millisecond}
+	defer c.Evict(client)
+
+	if _, _, err := c.List(client, cacheResourcePods, "default"); err == nil {
+		t.Fatal("没有权限时 List() 应返回错误")
+	}
+	mu.Lock()
+	first := lists
+	mu.Unlock()
+
+	// 同步失败后不再等待同步超时，也不重新创建 informer
+	start := time.Now()
+	if _, _, err := c.List(client, cacheResourcePods, "default"); err == nil {
+		t.Fatal("没有权限时 List() 应返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("第二次 List() 耗时 %s", elapsed)
+	}
+	mu.Lock()
+	second := lists
+	mu.Unlock()
+	if second != first || len(c.informers) != 0 {
+		t.Errorf("第二次 List() 重新创建了 informer, list 次数 %d -> %d", first, second)
+	}
+
+	// 集群移除后清除失败记录
+	c.Evict(client)
+	if len(c.failedUntil) != 0 {
+		t.Errorf("Evict() 后仍有 %d 条失败记录", len(c.failedUntil))
+	}
+}
+
+func TestGetPodsFromCache(t *testing.T) {
+	client := fake.NewSimpleClientset(newTestPod("nginx-1", "default", time.Hour))
+	defer Cache.Evict(client)
+
+	resp, err := Pod.GetPods(client, "default", &DataSelectorQuery{}, true)
+	if err != nil {
+		t.Fatalf("GetPods() error = %v", err)
+	}
+	if resp.Total != 1 || resp.Cache.Source != CacheSourceInformer {
+		t.Errorf("GetPods() total = %d, source = %s", resp.Total, resp.Cache.Source)
+	}
+	resp, err = Pod.GetPods(client, "default", &DataSelectorQuery{}, false)
+	if err != nil {
+		t.Fatalf("GetPods() error = %v", err)
+	}
+	if resp.Cache.Source != CacheSourceAPIServer {
+		t.Errorf("跳过缓存时 source = %s, want %s", resp.Cache.Source, CacheSourceAPIServer)
+	}
+}
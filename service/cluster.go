@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wonderivan/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"kubeadm-platform/config"
+)
+
+// ClusterInfo 定义集群列表的返回类型
+type ClusterInfo struct {
+	Name       string `json:"name"`
+	Kubeconfig string `json:"kubeconfig"`
+	// Ready 为 false 表示 client 初始化失败，原因见 Error
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// loadClusterRegistry 从文件或目录加载集群注册表
+// 文件：json 格式 {"集群名":"kubeconfig路径"}，相对路径按进程工作目录解析
+// 目录：每个文件为一个 kubeconfig，文件名去掉扩展名作为集群名，忽略隐藏文件和子目录
+func loadClusterRegistry(path string) (map[string]string, error) {
+	mp := make(map[string]string)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("读取集群注册表%s失败, %v", path, err))
+	}
+	if !info.IsDir() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("读取集群注册表%s失败, %v", path, err))
+		}
+		if err := json.Unmarshal(content, &mp); err != nil {
+			return nil, errors.New(fmt.Sprintf("集群注册表%s反序列化失败, %v", path, err))
+		}
+		return mp, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("读取集群目录%s失败, %v", path, err))
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		mp[name] = filepath.Join(path, entry.Name())
+	}
+	return mp, nil
+}
+
+// loadClusterEnv 读取以 config.ClusterKubeconfigEnvPrefix 开头的环境变量，返回集群名 -> kubeconfig 路径
+func loadClusterEnv() map[string]string {
+	mp := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, found := strings.Cut(kv, "=")
+		if !found || !strings.HasPrefix(key, config.ClusterKubeconfigEnvPrefix) || value == "" {
+			continue
+		}
+		name := strings.TrimPrefix(key, config.ClusterKubeconfigEnvPrefix)
+		if name == "" {
+			continue
+		}
+		mp[name] = value
+	}
+	return mp
+}
+
+// ListClusters 获取已注册的集群列表，按集群名排序
+func (k *k8s) ListClusters() []ClusterInfo {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	clusters := make([]ClusterInfo, 0, len(k.KubeConfMap))
+	for name, kubeconfig := range k.KubeConfMap {
+		_, ready := k.ClientMap[name]
+		clusters = append(clusters, ClusterInfo{
+			Name:       name,
+			Kubeconfig: kubeconfig,
+			Ready:      ready,
+			Error:      k.ErrMap[name],
+		})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Name < clusters[j].Name
+	})
+	return clusters
+}
+
+// AddCluster 注册新集群，client 创建失败时不注册
+func (k *k8s) AddCluster(name, kubeconfig string) (err error) {
+	if name == "" || kubeconfig == "" {
+		return errors.New("集群名和kubeconfig不能为空")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.KubeConfMap[name]; ok {
+		return errors.New(fmt.Sprintf("集群:%s已存在", name))
+	}
+	return k.setCluster(name, kubeconfig)
+}
+
+// UpdateCluster 更新已注册集群的 kubeconfig，新的 client 创建失败时保留原 client
+// 环境变量注册的集群不能更新
+func (k *k8s) UpdateCluster(name, kubeconfig string) (err error) {
+	if name == "" || kubeconfig == "" {
+		return errors.New("集群名和kubeconfig不能为空")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkMutable(name); err != nil {
+		return err
+	}
+	return k.setCluster(name, kubeconfig)
+}
+
+// RemoveCluster 移除集群，注册表写入失败时不移除，环境变量注册的集群不能移除
+func (k *k8s) RemoveCluster(name string) (err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkMutable(name); err != nil {
+		return err
+	}
+	registry := copyRegistry(k.registry)
+	delete(registry, name)
+	if err := k.saveRegistry(registry); err != nil {
+		return err
+	}
+	if old, ok := k.ClientMap[name]; ok {
+		Cache.Evict(old)
+	}
+	delete(k.KubeConfMap, name)
+	delete(k.ClientMap, name)
+	delete(k.ConfMap, name)
+	delete(k.ErrMap, name)
+	delete(k.healthMap, name)
+	k.registry = registry
+	logger.Info(fmt.Sprintf("集群%s:已移除", name))
+	return nil
+}
+
+// checkMutable 判断集群是否存在且可以在运行时修改，调用方需持有锁
+func (k *k8s) checkMutable(name string) error {
+	if _, ok := k.KubeConfMap[name]; !ok {
+		return errors.New(fmt.Sprintf("集群:%s不存在", name))
+	}
+	if k.envClusters[name] {
+		return errors.New(fmt.Sprintf("集群:%s由环境变量%s%s注册，只能通过环境变量修改", name, config.ClusterKubeconfigEnvPrefix, name))
+	}
+	return nil
+}
+
+// setCluster 创建 client 并写入注册表，注册表写入成功后才替换内存中的集群，调用方需持有写锁
+func (k *k8s) setCluster(name, kubeconfig string) error {
+	if k.NewClient == nil {
+		k.NewClient = newClientFromKubeconfig
+	}
+	client, conf, err := k.NewClient(kubeconfig)
+	if err != nil {
+		logger.Error(fmt.Sprintf("集群%s:%v", name, err))
+		return errors.New(fmt.Sprintf("集群%s:%v", name, err))
+	}
+	registry := copyRegistry(k.registry)
+	registry[name] = kubeconfig
+	if err := k.saveRegistry(registry); err != nil {
+		return err
+	}
+
+	if k.KubeConfMap == nil {
+		k.KubeConfMap = make(map[string]string)
+		k.ClientMap = make(map[string]kubernetes.Interface)
+		k.ErrMap = make(map[string]string)
+	}
+	if k.ConfMap == nil {
+		k.ConfMap = make(map[string]*rest.Config)
+	}
+	if old, ok := k.ClientMap[name]; ok {
+		Cache.Evict(old)
+	}
+	k.KubeConfMap[name] = kubeconfig
+	k.ClientMap[name] = client
+	k.ConfMap[name] = conf
+	delete(k.ErrMap, name)
+	delete(k.healthMap, name)
+	k.registry = registry
+	logger.Info(fmt.Sprintf("集群%s:创建K8sClient成功", name))
+	return nil
+}
+
+func copyRegistry(registry map[string]string) map[string]string {
+	mp := make(map[string]string, len(registry)+1)
+	for name, kubeconfig := range registry {
+		mp[name] = kubeconfig
+	}
+	return mp
+}
+
+// saveRegistry 将注册表写回来源文件，来源为目录或未设置时仅在内存中生效，调用方需持有写锁
+// 先写入同目录下的临时文件再重命名，写入中途失败不会损坏原文件
+func (k *k8s) saveRegistry(registry map[string]string) error {
+	if k.source == "" {
+		return nil
+	}
+	if info, err := os.Stat(k.source); err == nil && info.IsDir() {
+		logger.Warn(fmt.Sprintf("集群注册表%s为目录，运行时修改不会持久化", k.source))
+		return nil
+	}
+	content, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		logger.Error(fmt.Sprintf("序列化集群注册表失败, %v", err))
+		return errors.New(fmt.Sprintf("序列化集群注册表失败, %v", err))
+	}
+	if err := writeFileAtomic(k.source, append(content, '\n'), 0o644); err != nil {
+		logger.Error(fmt.Sprintf("写入集群注册表%s失败, %v", k.source, err))
+		return errors.New(fmt.Sprintf("写入集群注册表%s失败, %v", k.source, err))
+	}
+	return nil
+}
+
+// writeFileAtomic 通过临时文件和 rename 替换文件内容
+func writeFileAtomic(path string, content []byte, perm os.FileMode) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ClusterHealth 定义集群健康检查的返回类型
+type ClusterHealth struct {
+	ClusterInfo
+	// Reachable 表示在超时时间内成功访问了 apiserver
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version"`
+	// LatencyMs 为获取 apiserver 版本（discovery 调用）的耗时，单位毫秒
+	LatencyMs      int64  `json:"latency_ms"`
+	NodeCount      int    `json:"node_count"`
+	NamespaceCount int    `json:"namespace_count"`
+	ProbeError     string `json:"probe_error,omitempty"`
+	// CheckedAt 最近一次探测的时间，从未探测时为空
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// CachedClusterHealth 返回所有集群最近一次探测的结果，不访问 apiserver，按集群名排序返回
+func (k *k8s) CachedClusterHealth() []ClusterHealth {
+	clusters := k.ListClusters()
+	result := make([]ClusterHealth, len(clusters))
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for i, info := range clusters {
+		health, ok := k.healthMap[info.Name]
+		if !ok {
+			health = ClusterHealth{ProbeError: info.Error}
+		}
+		// 集群信息以当前注册的为准
+		health.ClusterInfo = info
+		result[i] = health
+	}
+	return result
+}
+
+// ProbeClusters 并发检查所有集群的健康状态，所有集群共用一个超时时间，按集群名排序返回
+func (k *k8s) ProbeClusters() []ClusterHealth {
+	ctx, cancel := context.WithTimeout(context.Background(), k.probeTimeout())
+	defer cancel()
+	clusters := k.ListClusters()
+	result := make([]ClusterHealth, len(clusters))
+	var wg sync.WaitGroup
+	for i := range clusters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result[i] = k.probe(ctx, clusters[i])
+		}(i)
+	}
+	wg.Wait()
+	return result
+}
+
+// ProbeCluster 检查单个集群的健康状态
+func (k *k8s) ProbeCluster(name string) (*ClusterHealth, error) {
+	for _, info := range k.ListClusters() {
+		if info.Name == name {
+			ctx, cancel := context.WithTimeout(context.Background(), k.probeTimeout())
+			defer cancel()
+			health := k.probe(ctx, info)
+			return &health, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("集群:%s不存在", name))
+}
+
+func (k *k8s) probeTimeout() time.Duration {
+	if k.ProbeTimeout == 0 {
+		return config.ClusterProbeTimeout
+	}
+	return k.ProbeTimeout
+}
+
+// probe 在 ctx 超时前完成版本、节点数、命名空间数的探测，结果记录到缓存中
+func (k *k8s) probe(ctx context.Context, info ClusterInfo) (health ClusterHealth) {
+	health = ClusterHealth{ClusterInfo: info}
+	defer func() {
+		now := time.Now()
+		health.CheckedAt = &now
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		// 探测期间集群被移除时不记录
+		if _, ok := k.KubeConfMap[info.Name]; !ok {
+			return
+		}
+		if k.healthMap == nil {
+			k.healthMap = make(map[string]ClusterHealth)
+		}
+		k.healthMap[info.Name] = health
+	}()
+	if !info.Ready {
+		health.ProbeError = info.Error
+		return health
+	}
+	client, err := k.GetClient(info.Name)
+	if err != nil {
+		health.ProbeError = err.Error()
+		return health
+	}
+	// 直接请求 /version，使请求受 ctx 超时控制，超时后连接随请求一起取消
+	restClient := client.Discovery().RESTClient()
+	if restClient == nil {
+		health.ProbeError = "获取集群版本失败, client不支持discovery请求"
+		return health
+	}
+	start := time.Now()
+	body, err := restClient.Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		health.ProbeError = fmt.Sprintf("获取集群版本失败, %v", err)
+		return health
+	}
+	health.LatencyMs = time.Since(start).Milliseconds()
+	var serverVersion version.Info
+	if err := json.Unmarshal(body, &serverVersion); err != nil {
+		health.ProbeError = fmt.Sprintf("解析集群版本失败, %v", err)
+		return health
+	}
+	health.Version = serverVersion.GitVersion
+	health.Reachable = true
+
+	// resourceVersion=0 时从 apiserver 的 watch cache 读取，开销较小
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{ResourceVersion: "0"})
+	if err != nil {
+		health.ProbeError = fmt.Sprintf("获取Node列表失败, %v", err)
+		return health
+	}
+	health.NodeCount = len(nodes.Items)
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{ResourceVersion: "0"})
+	if err != nil {
+		health.ProbeError = fmt.Sprintf("获取Namespace列表失败, %v", err)
+		return health
+	}
+	health.NamespaceCount = len(namespaces.Items)
+	return health
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"kubeadm-platform/config"
+)
+
+// fakeClientFactory kubeconfig 路径中包含 broken 时返回错误，其余返回 fake clientset，rest 配置的 Host 为 kubeconfig 路径
+func fakeClientFactory(kubeconfig string) (kubernetes.Interface, *rest.Config, error) {
+	if strings.Contains(kubeconfig, "broken") {
+		return nil, nil, errors.New("invalid kubeconfig")
+	}
+	return fake.NewSimpleClientset(), &rest.Config{Host: kubeconfig}, nil
+}
+
+// writeRegistry 在临时目录中写入注册表文件并返回路径
+func writeRegistry(t *testing.T, mp map[string]string) string {
+	t.Helper()
+	content, err := json.Marshal(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "clusters.json")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestK8sInit(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"dev.yaml", "prod.conf", ".hidden"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		source     string
+		env        map[string]string
+		wantReady  []string
+		wantBroken []string
+	}{
+		{
+			name:       "从文件加载，单个集群失败不影响其他集群",
+			source:     writeRegistry(t, map[string]string{"TST-1": "tst1.conf", "TST-2": "broken.conf"}),
+			wantReady:  []string{"TST-1"},
+			wantBroken: []string{"TST-2"},
+		},
+		{
+			name:      "从目录加载，文件名即集群名",
+			source:    dir,
+			wantReady: []string{"dev", "prod"},
+		},
+		{
+			name:      "环境变量覆盖和新增集群",
+			source:    writeRegistry(t, map[string]string{"TST-1": "broken.conf"}),
+			env:       map[string]string{config.ClusterKubeconfigEnvPrefix + "TST-1": "tst1.conf", config.ClusterKubeconfigEnvPrefix + "TST-3": "tst3.conf"},
+			wantReady: []string{"TST-1", "TST-3"},
+		},
+		{
+			name:   "注册表不存在时集群列表为空",
+			source: filepath.Join(t.TempDir(), "missing.json"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(config.ClusterConfigPathEnv, tt.source)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			k := &k8s{NewClient: fakeClientFactory}
+			k.Init()
+
+			for _, name := range tt.wantReady {
+				if _, err := k.GetClient(name); err != nil {
+					t.Errorf("GetClient(%s) error = %v", name, err)
+				}
+			}
+			for _, name := range tt.wantBroken {
+				if _, err := k.GetClient(name); err == nil {
+					t.Errorf("GetClient(%s) 应返回错误", name)
+				}
+				if k.ErrMap[name] == "" {
+					t.Errorf("ErrMap 未记录集群 %s 的错误", name)
+				}
+			}
+			if got, want := len(k.ListClusters()), len(tt.wantReady)+len(tt.wantBroken); got != want {
+				t.Errorf("ListClusters() 返回 %d 个集群, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestK8sClusterRegistry(t *testing.T) {
+	source := writeRegistry(t, map[string]string{"TST-1": "tst1.conf"})
+	t.Setenv(config.ClusterConfigPathEnv, source)
+	t.Setenv(config.ClusterKubeconfigEnvPrefix+"ENV-1", "env1.conf")
+	k := &k8s{NewClient: fakeClientFactory}
+	k.Init()
+
+	// 注册
+	if err := k.AddCluster("TST-2", "tst2.conf"); err != nil {
+		t.Fatalf("AddCluster() error = %v", err)
+	}
+	if err := k.AddCluster("TST-2", "tst2.conf"); err == nil {
+		t.Errorf("重复注册应返回错误")
+	}
+	if err := k.AddCluster("TST-3", "broken.conf"); err == nil {
+		t.Errorf("kubeconfig 无效时应返回错误")
+	}
+	if _, ok := k.KubeConfMap["TST-3"]; ok {
+		t.Errorf("kubeconfig 无效的集群不应注册")
+	}
+
+	// 更新失败时保留原 client
+	old, _ := k.GetClient("TST-2")
+	if err := k.UpdateCluster("TST-2", "broken.conf"); err == nil {
+		t.Errorf("kubeconfig 无效时应返回错误")
+	}
+	if client, _ := k.GetClient("TST-2"); client != old {
+		t.Errorf("更新失败后 client 被替换")
+	}
+	if err := k.UpdateCluster("TST-2", "tst2-new.conf"); err != nil {
+		t.Fatalf("UpdateCluster() error = %v", err)
+	}
+	// rest 配置随 client 一起更新，返回的是副本
+	conf, err := k.GetRestConfig("TST-2")
+	if err != nil || conf.Host != "tst2-new.conf" {
+		t.Fatalf("GetRestConfig() = %+v, %v", conf, err)
+	}
+	conf.Host = "changed"
+	if conf, _ := k.GetRestConfig("TST-2"); conf.Host != "tst2-new.conf" {
+		t.Errorf("修改 GetRestConfig() 的返回值影响了缓存的配置")
+	}
+	if err := k.UpdateCluster("missing", "missing.conf"); err == nil {
+		t.Errorf("更新不存在的集群应返回错误")
+	}
+	if err := k.UpdateCluster("ENV-1", "env1-new.conf"); err == nil || k.KubeConfMap["ENV-1"] != "env1.conf" {
+		t.Errorf("环境变量注册的集群不应被更新, error = %v", err)
+	}
+	if err := k.RemoveCluster("ENV-1"); err == nil {
+		t.Errorf("环境变量注册的集群不应被移除")
+	}
+
+	// 移除
+	if err := k.RemoveCluster("TST-1"); err != nil {
+		t.Fatalf("RemoveCluster() error = %v", err)
+	}
+	if _, err := k.GetClient("TST-1"); err == nil {
+		t.Errorf("移除后仍能获取 client")
+	}
+	if _, ok := k.ConfMap["TST-1"]; ok {
+		t.Errorf("移除后仍缓存 rest 配置")
+	}
+
+	// 运行时修改写回注册表文件，环境变量注册的集群不写回
+	saved, err := loadClusterRegistry(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"TST-2": "tst2-new.conf"}
+	if len(saved) != len(want) || saved["TST-2"] != want["TST-2"] {
+		t.Errorf("注册表文件内容 = %v, want %v", saved, want)
+	}
+}
+
+func TestK8sClusterRegistryCorrupt(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "clusters.json")
+	content := []byte(`{"TST-1": "tst1.conf",`)
+	if err := os.WriteFile(source, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(config.ClusterConfigPathEnv, source)
+	k := &k8s{NewClient: fakeClientFactory}
+	k.Init()
+
+	if err := k.AddCluster("TST-2", "tst2.conf"); err != nil {
+		t.Fatalf("AddCluster() error = %v", err)
+	}
+	saved, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != string(content) {
+		t.Errorf("无法读取的注册表被覆盖, 内容 = %s", saved)
+	}
+}
+
+func TestK8sClusterRegistrySaveFailed(t *testing.T) {
+	source := writeRegistry(t, map[string]string{"TST-1": "tst1.conf"})
+	t.Setenv(config.ClusterConfigPathEnv, source)
+	k := &k8s{NewClient: fakeClientFactory}
+	k.Init()
+	old, _ := k.GetClient("TST-1")
+	// 删除注册表所在目录，使写入失败
+	if err := os.RemoveAll(filepath.Dir(source)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.AddCluster("TST-2", "tst2.conf"); err == nil {
+		t.Errorf("注册表写入失败时应返回错误")
+	}
+	if _, err := k.GetClient("TST-2"); err == nil {
+		t.Errorf("注册表写入失败时不应注册集群")
+	}
+	if err := k.UpdateCluster("TST-1", "tst1-new.conf"); err == nil {
+		t.Errorf("注册表写入失败时应返回错误")
+	}
+	if client, _ := k.GetClient("TST-1"); client != old || k.KubeConfMap["TST-1"] != "tst1.conf" {
+		t.Errorf("注册表写入失败后集群被更新")
+	}
+	if err := k.RemoveCluster("TST-1"); err == nil {
+		t.Errorf("注册表写入失败时应返回错误")
+	}
+	if client, _ := k.GetClient("TST-1"); client != old || k.registry["TST-1"] != "tst1.conf" {
+		t.Errorf("注册表写入失败后集群被移除")
+	}
+}
+
+// newTestAPIServer 启动模拟 apiserver 的 http 服务，返回连接该服务的 clientset
+func newTestAPIServer(t *testing.T, handler http.HandlerFunc) kubernetes.Interface {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestK8sProbeClusters(t *testing.T) {
+	healthy := newTestAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/version":
+			json.NewEncoder(w).Encode(version.Info{GitVersion: "v1.27.1"})
+		case "/api/v1/nodes":
+			json.NewEncoder(w).Encode(corev1.NodeList{Items: []corev1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+			}})
+		case "/api/v1/namespaces":
+			json.NewEncoder(w).Encode(corev1.NamespaceList{Items: []corev1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "default"}}}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	unreachable := newTestAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "connection refused", http.StatusServiceUnavailable)
+	})
+	// 请求一直不返回，超时后应取消请求
+	canceled := make(chan struct{})
+	hanging := newTestAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	})
+
+	k := &k8s{
+		ClientMap:    map[string]kubernetes.Interface{"healthy": healthy, "unreachable": unreachable, "hanging": hanging},
+		KubeConfMap:  map[string]string{"healthy": "a.conf", "unreachable": "b.conf", "hanging": "d.conf", "broken": "c.conf"},
+		ErrMap:       map[string]string{"broken": "invalid kubeconfig"},
+		ProbeTimeout: 200 * time.Millisecond,
+	}
+	// 探测前缓存中只有初始化的结果
+	for _, health := range k.CachedClusterHealth() {
+		if health.CheckedAt != nil || health.Reachable {
+			t.Errorf("CachedClusterHealth() 探测前 = %+v", health)
+		}
+	}
+	start := time.Now()
+	result := k.ProbeClusters()
+	// 所有集群共用一个超时时间
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ProbeClusters() 耗时 %s", elapsed)
+	}
+	if len(result) != 4 {
+		t.Fatalf("ProbeClusters() 返回 %d 个集群, want 4", len(result))
+	}
+	got := make(map[string]ClusterHealth, len(result))
+	for _, health := range result {
+		got[health.Name] = health
+	}
+
+	if h := got["healthy"]; !h.Reachable || h.Version != "v1.27.1" || h.NodeCount != 2 || h.NamespaceCount != 1 || h.ProbeError != "" {
+		t.Errorf("healthy = %+v", h)
+	}
+	if h := got["unreachable"]; h.Reachable || h.ProbeError == "" {
+		t.Errorf("unreachable = %+v", h)
+	}
+	if h := got["hanging"]; h.Reachable || !strings.Contains(h.ProbeError, "获取集群版本失败") {
+		t.Errorf("hanging = %+v", h)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("探测超时后请求未取消")
+	}
+	if h := got["broken"]; h.Reachable || h.ProbeError != "invalid kubeconfig" {
+		t.Errorf("broken = %+v", h)
+	}
+	for _, health := range k.CachedClusterHealth() {
+		if health.CheckedAt == nil || health.Reachable != got[health.Name].Reachable || health.Version != got[health.Name].Version {
+			t.Errorf("CachedClusterHealth() = %+v, want %+v", health, got[health.Name])
+		}
+	}
+	if _, err := k.ProbeCluster("missing"); err == nil {
+		t.Errorf("ProbeCluster() 集群不存在时应返回错误")
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wonderivan/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var DaemonSet daemonSet
+
+type daemonSet struct{}
+
+// RestartDaemonSet 重启 DaemonSet，按 updateStrategy 在每个节点上重建 pod
+// updateStrategy 为 OnDelete 时只更新模板，pod 需手动删除后才会重建
+func (d *daemonSet) RestartDaemonSet(client kubernetes.Interface, daemonSetName, namespace string) (err error) {
+	patchByte, err := restartPatch()
+	if err != nil {
+		logger.Error(fmt.Sprintf("序列化失败, %v", err))
+		return errors.New(fmt.Sprintf("序列化失败, %v", err))
+	}
+	_, err = client.AppsV1().DaemonSets(namespace).Patch(context.TODO(), daemonSetName,
+		"application/strategic-merge-patch+json", patchByte, metav1.PatchOptions{})
+	if err != nil {
+		logger.Error(fmt.Sprintf("重启DaemonSet失败, %v", err))
+		return errors.New(fmt.Sprintf("重启DaemonSet失败, %v", err))
+	}
+	return nil
+}
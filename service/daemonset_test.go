@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRestartDaemonSet(t *testing.T) {
+	client := fake.NewSimpleClientset(&appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "fluent-bit", Namespace: "default"},
+	})
+	if err := DaemonSet.RestartDaemonSet(client, "fluent-bit", "default"); err != nil {
+		t.Fatalf("RestartDaemonSet() error = %v", err)
+	}
+	ds, err := client.AppsV1().DaemonSets("default").Get(context.TODO(), "fluent-bit", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(time.RFC3339, ds.Spec.Template.Annotations[restartedAtAnnotation]); err != nil {
+		t.Errorf("pod 模板未设置 %s 注解, annotations = %v", restartedAtAnnotation, ds.Spec.Template.Annotations)
+	}
+	if err := DaemonSet.RestartDaemonSet(client, "missing", "default"); err == nil {
+		t.Errorf("RestartDaemonSet() daemonset 不存在时应返回错误")
+	}
+}
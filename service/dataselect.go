@@ -1,109 +1,458 @@
 package service
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
 
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"kubeadm-platform/config"
 )
 
-// 用于封装排序、过滤、分页的数据类型
-type dataSelector struct {
-	GenericDataList   []DataCell
+// Selector 用于封装排序、过滤、分页的泛型数据类型，T 为资源类型，如 corev1.Pod
+// 内部只对元素指针进行过滤和排序，Items 时才复制当前页的元素
+type Selector[T any] struct {
+	items             []*T
+	accessor          *Accessor[T]
 	dataSelectorQuery *DataSelectorQuery
 }
 
-// DataCell 用于各种资源list的类型转换，转换后可以使用dataSelector的排序、过滤、分页
-type DataCell interface {
-	// GetCreation 用于排序
-	GetCreation() time.Time
-	// GetName 用于过滤
-	GetName() string
+// Accessor 定义从资源对象中读取过滤、排序字段的方法，新增资源类型只需定义一个 Accessor
+// 除 Name 和 Creation 外均可为 nil，为 nil 时对应的过滤条件不匹配任何元素
+type Accessor[T any] struct {
+	// Name 用于名称过滤
+	Name func(*T) string
+	// Creation 用于默认排序
+	Creation func(*T) time.Time
+	// Namespace 用于命名空间过滤
+	Namespace func(*T) string
+	// Labels 用于标签选择器过滤
+	Labels func(*T) map[string]string
+	// Fields 用于字段选择器过滤，返回该资源支持的字段及其值
+	Fields func(*T) fields.Set
+	// Status 用于状态过滤，pod 为 phase，deployment 为 available / unavailable
+	Status func(*T) string
+	// NodeName 用于节点过滤
+	NodeName func(*T) string
+	// Images 用于镜像过滤
+	Images func(*T) []string
+	// SortFields 声明该资源支持的排序字段及取值方法，值的类型为 string、int64 或 time.Time
+	SortFields map[string]func(*T) interface{}
 }
 
+// 排序字段，每种资源通过 Accessor.SortFields 声明支持其中的哪些
+const (
+	SortByName      = "name"
+	SortByCreation  = "creation"
+	SortByNamespace = "namespace"
+	// SortByRestarts 容器重启次数之和
+	SortByRestarts = "restarts"
+	// SortByReady pod 为就绪的容器数，deployment 为就绪副本数
+	SortByReady = "ready"
+	// SortByCPU CPU requests，单位为毫核
+	SortByCPU = "cpu"
+	// SortByMemory 内存 requests，单位为字节
+	SortByMemory = "memory"
+)
+
 // DataSelectorQuery 定义过滤和分页的属性，过滤：Name，分页：Limit 和 page
 type DataSelectorQuery struct {
 	// 用于过滤
 	FilterQuery *FilterQuery
+	// 用于排序，为空时按创建时间倒序
+	SortQuery *SortQuery
 	// 用于分页
 	PaginateQuery *PaginateQuery
 }
 
+// FilterQuery 定义过滤条件，各条件之间为"与"的关系，为空的条件不参与过滤
 type FilterQuery struct {
+	// Name 名称子串
 	Name string
+	// LabelSelector 标签选择器表达式，如 app=nginx,env in (prod,staging)
+	LabelSelector string
+	// FieldSelector 字段选择器表达式，如 spec.nodeName=node-1,status.phase!=Running
+	FieldSelector string
+	// Namespaces 命名空间，多个用逗号分隔，用于跨命名空间查询时的过滤
+	Namespaces string
+	// Status 状态，pod 为 phase（Running、Pending 等），deployment 为 available / unavailable，忽略大小写
+	Status string
+	// NodeName 节点名，精确匹配
+	NodeName string
+	// Image 镜像子串，任一容器的镜像匹配即可
+	Image string
+	// Regex 为 true 时 Name 和 Image 按正则表达式匹配
+	Regex bool
+	// IgnoreCase 为 true 时 Name 和 Image 忽略大小写
+	IgnoreCase bool
+
+	// 以下为 compile 解析后的匹配器
+	labelSelector labels.Selector
+	fieldSelector fields.Selector
+	namespaces    map[string]bool
+	nameRegexp    *regexp.Regexp
+	imageRegexp   *regexp.Regexp
+}
+
+// SortQuery 定义排序规格
+type SortQuery struct {
+	// SortBy 多个字段用逗号分隔，按先后顺序比较，字段前加 - 表示降序，如 name,-restarts
+	SortBy string
+
+	// compile 解析后的排序字段
+	keys []sortKey
+}
+
+type sortKey struct {
+	field string
+	desc  bool
 }
 
 type PaginateQuery struct {
 	Limit int
 	Page  int
+	// CursorMode 为 true 时使用 apiserver 的 limit/continue 游标分页，Page 不生效
+	CursorMode bool
+	// Cursor 游标分页时上一页返回的游标，为空表示第一页
+	Cursor string
+}
+
+// cursorListOptions 根据游标分页参数生成 ListOptions，标签和字段选择器下推到 apiserver
+func (q *DataSelectorQuery) cursorListOptions() (metav1.ListOptions, error) {
+	if len(q.SortQuery.keys) > 0 {
+		return metav1.ListOptions{}, errors.New("游标分页按 apiserver 返回顺序排列，不支持 sort_by")
+	}
+	limit := q.PaginateQuery.Limit
+	if limit <= 0 {
+		limit = config.CursorPageLimit
+	}
+	if limit > config.CursorPageMaxLimit {
+		limit = config.CursorPageMaxLimit
+	}
+	token, err := base64.RawURLEncoding.DecodeString(q.PaginateQuery.Cursor)
+	if err != nil {
+		return metav1.ListOptions{}, errors.New(fmt.Sprintf("游标不合法, %v", err))
+	}
+	return metav1.ListOptions{
+		LabelSelector: q.FilterQuery.LabelSelector,
+		FieldSelector: q.FilterQuery.FieldSelector,
+		Limit:         int64(limit),
+		Continue:      string(token),
+	}, nil
 }
 
-// 排序，实现自定义结构的排序，需要重写Len、Swap、Less方法
+// encodeCursor 将 apiserver 返回的 continue token 编码为对外的游标
+func encodeCursor(token string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
 
-// Len 方法用于获取数组长度
-func (d *dataSelector) Len() int {
-	return len(d.GenericDataList)
+// cursorListError 转换游标分页 List 的错误，continue token 过期时提示从第一页重新查询
+func cursorListError(err error) error {
+	if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+		return errors.New(fmt.Sprintf("游标已过期，请从第一页重新查询, %v", err))
+	}
+	return err
 }
 
-// Swap 方法用于数组中的元素在比较大小后怎么交换位置，可定义升降序
-func (d *dataSelector) Swap(i, j int) {
-	// i,j 是切片的下标
-	d.GenericDataList[i], d.GenericDataList[j] = d.GenericDataList[j], d.GenericDataList[i]
+// NewSelector 创建 Selector，query 需已通过 compile 校验
+func NewSelector[T any](items []T, query *DataSelectorQuery, accessor *Accessor[T]) *Selector[T] {
+	ptrs := make([]*T, len(items))
+	for i := range items {
+		ptrs[i] = &items[i]
+	}
+	return &Selector[T]{items: ptrs, accessor: accessor, dataSelectorQuery: query.complete()}
 }
 
-// Less 方法用于定义数组中元素排序的“大小”的比较方式
-func (d *dataSelector) Less(i, j int) bool {
-	a := d.GenericDataList[i].GetCreation()
-	b := d.GenericDataList[j].GetCreation()
-	return b.Before(a)
+// complete 补全为空的查询条件
+func (q *DataSelectorQuery) complete() *DataSelectorQuery {
+	if q == nil {
+		q = &DataSelectorQuery{}
+	}
+	if q.FilterQuery == nil {
+		q.FilterQuery = &FilterQuery{}
+	}
+	if q.SortQuery == nil {
+		q.SortQuery = &SortQuery{}
+	}
+	if q.PaginateQuery == nil {
+		q.PaginateQuery = &PaginateQuery{}
+	}
+	return q
 }
 
-// Sort 重写以上3个方法用使用 sort.Sort 进行排序
-func (d *dataSelector) Sort() *dataSelector {
-	sort.Sort(d)
-	return d
+// compile 补全为空的查询条件，并按 sortable 校验和解析过滤、排序条件，需在创建 Selector 之前调用
+func (q *DataSelectorQuery) compile(sortable []string) error {
+	q.complete()
+	if err := q.FilterQuery.compile(); err != nil {
+		return err
+	}
+	return q.SortQuery.compile(sortable)
 }
 
-// Filter 过滤
-// 用于过滤元素，比较元素的 Name 属性，若包含，则返回
-func (d *dataSelector) Filter() *dataSelector {
-	// 若 Name 的传参为空，则返回所有元素
-	if d.dataSelectorQuery.FilterQuery.Name == "" {
-		return d
-	}
-	// 若 Name 的传参不为空，则返回元素中包含Name的所有元素
-	// 定义一个列表
-	filteredList := []DataCell{}
-	// 遍历所有数据
-	for _, value := range d.GenericDataList {
-		// 定义一个是否匹配的值
-		matched := true
-		// 获取对象的 Name
-		objName := value.GetName()
-		// 如果数据中不包含要过滤的 Name,则 matched 为 flase
-		if !strings.Contains(objName, d.dataSelectorQuery.FilterQuery.Name) {
-			matched = false
+// sortableFields 返回该资源支持的排序字段，按字母顺序排列
+func (a *Accessor[T]) sortableFields() []string {
+	fields := make([]string, 0, len(a.SortFields))
+	for field := range a.SortFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Len 返回当前元素个数，在 Filter 之后调用即为过滤后的总数
+func (s *Selector[T]) Len() int {
+	return len(s.items)
+}
+
+// Items 返回当前元素的副本
+func (s *Selector[T]) Items() []T {
+	items := make([]T, len(s.items))
+	for i, item := range s.items {
+		items[i] = *item
+	}
+	return items
+}
+
+// Sort 排序，所有排序字段都相等的元素保持原有顺序
+// 未指定排序字段时按创建时间倒序，否则依次比较各排序字段，直到分出大小
+func (s *Selector[T]) Sort() *Selector[T] {
+	keys := s.dataSelectorQuery.SortQuery.keys
+	if len(keys) == 0 {
+		sort.SliceStable(s.items, func(i, j int) bool {
+			return s.accessor.Creation(s.items[j]).Before(s.accessor.Creation(s.items[i]))
+		})
+		return s
+	}
+	getters := make([]func(*T) interface{}, len(keys))
+	for i, key := range keys {
+		getters[i] = s.accessor.SortFields[key.field]
+	}
+	sort.SliceStable(s.items, func(i, j int) bool {
+		for k, key := range keys {
+			cmp := compareSortValue(getters[k](s.items[i]), getters[k](s.items[j]))
+			if cmp == 0 {
+				continue
+			}
+			if key.desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+	return s
+}
+
+// compile 解析 SortBy 并校验字段是否在 sortable 中，需在 Sort 之前调用
+func (s *SortQuery) compile(sortable []string) error {
+	s.keys = nil
+	if strings.TrimSpace(s.SortBy) == "" {
+		return nil
+	}
+	allowed := make(map[string]bool, len(sortable))
+	for _, field := range sortable {
+		allowed[field] = true
+	}
+	for _, field := range strings.Split(s.SortBy, ",") {
+		field = strings.TrimSpace(field)
+		key := sortKey{field: strings.TrimPrefix(field, "+")}
+		if strings.HasPrefix(field, "-") {
+			key = sortKey{field: strings.TrimPrefix(field, "-"), desc: true}
+		}
+		if !allowed[key.field] {
+			return errors.New(fmt.Sprintf("不支持的排序字段%q，可选值为 %s", key.field, strings.Join(sortable, ",")))
+		}
+		s.keys = append(s.keys, key)
+	}
+	return nil
+}
+
+// compareSortValue 比较两个排序值，a < b 返回 -1，相等返回 0，a > b 返回 1
+func compareSortValue(a, b interface{}) int {
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	case int64:
+		bv := b.(int64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	case time.Time:
+		bv := b.(time.Time)
+		switch {
+		case av.Before(bv):
+			return -1
+		case av.After(bv):
+			return 1
+		}
+	}
+	return 0
+}
+
+// sumRequests 计算容器 requests 之和，CPU 单位为毫核，内存单位为字节
+func sumRequests(containers []corev1.Container, name corev1.ResourceName) int64 {
+	var total int64
+	for _, c := range containers {
+		quantity, ok := c.Resources.Requests[name]
+		if !ok {
 			continue
 		}
-		// 如果匹配到要过滤的 Name,则将数据添加到 filteredList 中
-		if matched {
-			filteredList = append(filteredList, value)
+		if name == corev1.ResourceCPU {
+			total += quantity.MilliValue()
+		} else {
+			total += quantity.Value()
+		}
+	}
+	return total
+}
+
+// containerImages 返回 init 容器和普通容器的镜像
+func containerImages(spec *corev1.PodSpec) []string {
+	images := make([]string, 0, len(spec.InitContainers)+len(spec.Containers))
+	for _, c := range spec.InitContainers {
+		images = append(images, c.Image)
+	}
+	for _, c := range spec.Containers {
+		images = append(images, c.Image)
+	}
+	return images
+}
+
+// compile 校验并解析过滤条件，需在 Filter 之前调用
+func (f *FilterQuery) compile() (err error) {
+	f.labelSelector, f.fieldSelector, f.namespaces = nil, nil, nil
+	f.nameRegexp, f.imageRegexp = nil, nil
+	if f.LabelSelector != "" {
+		if f.labelSelector, err = labels.Parse(f.LabelSelector); err != nil {
+			return errors.New(fmt.Sprintf("标签选择器不合法, %v", err))
+		}
+	}
+	if f.FieldSelector != "" {
+		if f.fieldSelector, err = fields.ParseSelector(f.FieldSelector); err != nil {
+			return errors.New(fmt.Sprintf("字段选择器不合法, %v", err))
+		}
+	}
+	if f.Namespaces != "" {
+		f.namespaces = make(map[string]bool)
+		for _, ns := range strings.Split(f.Namespaces, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				f.namespaces[ns] = true
+			}
+		}
+	}
+	if f.Regex {
+		if f.nameRegexp, err = f.compileRegexp(f.Name); err != nil {
+			return errors.New(fmt.Sprintf("名称正则表达式不合法, %v", err))
+		}
+		if f.imageRegexp, err = f.compileRegexp(f.Image); err != nil {
+			return errors.New(fmt.Sprintf("镜像正则表达式不合法, %v", err))
 		}
 	}
-	// 将 filteredList 赋值给 d.GenericDataList 并返回
-	d.GenericDataList = filteredList
-	return d
+	return nil
+}
+
+func (f *FilterQuery) compileRegexp(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	if f.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// isEmpty 判断是否没有任何过滤条件
+func (f *FilterQuery) isEmpty() bool {
+	return f.Name == "" && f.LabelSelector == "" && f.FieldSelector == "" && f.Namespaces == "" &&
+		f.Status == "" && f.NodeName == "" && f.Image == ""
+}
+
+// matchString 按 Regex / IgnoreCase 配置判断 value 是否匹配 pattern
+func (f *FilterQuery) matchString(value, pattern string, re *regexp.Regexp) bool {
+	if re != nil {
+		return re.MatchString(value)
+	}
+	if f.IgnoreCase {
+		return strings.Contains(strings.ToLower(value), strings.ToLower(pattern))
+	}
+	return strings.Contains(value, pattern)
+}
+
+// match 判断元素是否满足所有过滤条件
+func (s *Selector[T]) match(item *T) bool {
+	f, a := s.dataSelectorQuery.FilterQuery, s.accessor
+	if f.Name != "" && !f.matchString(a.Name(item), f.Name, f.nameRegexp) {
+		return false
+	}
+	if f.namespaces != nil && (a.Namespace == nil || !f.namespaces[a.Namespace(item)]) {
+		return false
+	}
+	if f.labelSelector != nil && (a.Labels == nil || !f.labelSelector.Matches(labels.Set(a.Labels(item)))) {
+		return false
+	}
+	if f.fieldSelector != nil && (a.Fields == nil || !f.fieldSelector.Matches(a.Fields(item))) {
+		return false
+	}
+	if f.Status != "" && (a.Status == nil || !strings.EqualFold(a.Status(item), f.Status)) {
+		return false
+	}
+	if f.NodeName != "" && (a.NodeName == nil || a.NodeName(item) != f.NodeName) {
+		return false
+	}
+	if f.Image != "" {
+		if a.Images == nil {
+			return false
+		}
+		matched := false
+		for _, image := range a.Images(item) {
+			if f.matchString(image, f.Image, f.imageRegexp) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter 过滤
+// 用于过滤元素，返回满足 FilterQuery 中所有条件的元素
+func (s *Selector[T]) Filter() *Selector[T] {
+	// 若没有过滤条件，则返回所有元素
+	if s.dataSelectorQuery.FilterQuery.isEmpty() {
+		return s
+	}
+	filteredList := make([]*T, 0, len(s.items))
+	for _, item := range s.items {
+		if s.match(item) {
+			filteredList = append(filteredList, item)
+		}
+	}
+	s.items = filteredList
+	return s
 }
 
 // Paginate 用于数组分页，根据 Limit 和 Page 的传参，返回数据
-func (d *dataSelector) Paginate() *dataSelector {
-	limit := d.dataSelectorQuery.PaginateQuery.Limit
-	page := d.dataSelectorQuery.PaginateQuery.Page
+func (s *Selector[T]) Paginate() *Selector[T] {
+	limit := s.dataSelectorQuery.PaginateQuery.Limit
+	page := s.dataSelectorQuery.PaginateQuery.Page
 	// 验证参数合法，若参数不合法，则返回所有数据
 	if limit <= 0 || page <= 0 {
-		return d
+		return s
 	}
 	// 定义offset
 	// 举例：25个元素的切片 limit10
@@ -113,36 +462,12 @@ func (d *dataSelector) Paginate() *dataSelector {
 	// 含头不含尾
 	startIndex := limit * (page - 1)
 	endIndex := limit * page
-	if len(d.GenericDataList) < endIndex {
-		endIndex = len(d.GenericDataList)
+	if len(s.items) < endIndex {
+		endIndex = len(s.items)
 	}
 	if startIndex > endIndex {
-		return d
+		return s
 	}
-	d.GenericDataList = d.GenericDataList[startIndex:endIndex]
-	return d
-}
-
-// 定义 podCell 类型，实现两个方法 GetCreation GetName，可进行类型转换
-type podCell corev1.Pod
-
-// GetCreation 获取 创建时间 这里 (p podCell) 没有使用指针
-func (p podCell) GetCreation() time.Time {
-	return p.CreationTimestamp.Time
-}
-
-// GetName 获取 名称
-func (p podCell) GetName() string {
-	return p.Name
-}
-
-// 定义 deploymentCell 类型，实现两个方法 GetCreation GetName，可进行类型转换
-type deploymentCell appsv1.Deployment
-
-func (d deploymentCell) GetCreation() time.Time {
-	return d.CreationTimestamp.Time
-}
-
-func (d deploymentCell) GetName() string {
-	return d.Name
+	s.items = s.items[startIndex:endIndex]
+	return s
 }
@@ -0,0 +1,372 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kubeadm-platform/config"
+)
+
+// filterTestPods 过滤测试使用的 pod 列表
+func filterTestPods() []corev1.Pod {
+	newPod := func(name, namespace, node, image string, phase corev1.PodPhase, labels map[string]string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+			Spec: corev1.PodSpec{
+				NodeName:   node,
+				Containers: []corev1.Container{{Name: "main", Image: image}},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	return []corev1.Pod{
+		newPod("nginx-web-1", "default", "node-1", "nginx:1.25", corev1.PodRunning, map[string]string{"app": "nginx", "env": "prod"}),
+		newPod("nginx-web-2", "default", "node-2", "nginx:1.24", corev1.PodPending, map[string]string{"app": "nginx", "env": "staging"}),
+		newPod("Redis-Cache", "cache", "node-1", "redis:7", corev1.PodRunning, map[string]string{"app": "redis", "env": "prod"}),
+		newPod("job-migrate", "default", "node-2", "registry.local/tools/migrate:v3", corev1.PodSucceeded, nil),
+	}
+}
+
+func TestDataSelectorFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    FilterQuery
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "无过滤条件", filter: FilterQuery{}, wantNames: []string{"nginx-web-1", "nginx-web-2", "Redis-Cache", "job-migrate"}},
+		{name: "名称子串区分大小写", filter: FilterQuery{Name: "redis"}, wantNames: []string{}},
+		{name: "名称忽略大小写", filter: FilterQuery{Name: "redis", IgnoreCase: true}, wantNames: []string{"Redis-Cache"}},
+		{name: "名称正则", filter: FilterQuery{Name: `^nginx-web-\d$`, Regex: true}, wantNames: []string{"nginx-web-1", "nginx-web-2"}},
+		{name: "正则忽略大小写", filter: FilterQuery{Name: `^redis`, Regex: true, IgnoreCase: true}, wantNames: []string{"Redis-Cache"}},
+		{name: "标签选择器", filter: FilterQuery{LabelSelector: "app=nginx,env in (prod)"}, wantNames: []string{"nginx-web-1"}},
+		{name: "标签不存在", filter: FilterQuery{LabelSelector: "!app"}, wantNames: []string{"job-migrate"}},
+		{name: "字段选择器", filter: FilterQuery{FieldSelector: "spec.nodeName=node-2,status.phase!=Pending"}, wantNames: []string{"job-migrate"}},
+		{name: "多个命名空间", filter: FilterQuery{Namespaces: "cache, kube-system"}, wantNames: []string{"Redis-Cache"}},
+		{name: "状态忽略大小写", filter: FilterQuery{Status: "running"}, wantNames: []string{"nginx-web-1", "Redis-Cache"}},
+		{name: "节点名", filter: FilterQuery{NodeName: "node-1", Name: "nginx"}, wantNames: []string{"nginx-web-1"}},
+		{name: "镜像子串", filter: FilterQuery{Image: "migrate"}, wantNames: []string{"job-migrate"}},
+		{name: "镜像正则", filter: FilterQuery{Image: `:1\.2[45]$`, Regex: true}, wantNames: []string{"nginx-web-1", "nginx-web-2"}},
+		{name: "标签选择器不合法", filter: FilterQuery{LabelSelector: "app in ("}, wantErr: true},
+		{name: "字段选择器不合法", filter: FilterQuery{FieldSelector: "spec.nodeName"}, wantErr: true},
+		{name: "正则不合法", filter: FilterQuery{Name: "nginx(", Regex: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			query := &DataSelectorQuery{FilterQuery: &filter}
+			err := query.compile(podAccessor.sortableFields())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := NewSelector(filterTestPods(), query, podAccessor).Filter().Items()
+			if len(got) != len(tt.wantNames) {
+				t.Fatalf("Filter() got %d items, want %d", len(got), len(tt.wantNames))
+			}
+			for i := range got {
+				if got[i].Name != tt.wantNames[i] {
+					t.Errorf("Filter() items[%d] = %s, want %s", i, got[i].Name, tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCursorListOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        *DataSelectorQuery
+		wantLimit    int64
+		wantContinue string
+		wantErr      bool
+	}{
+		{
+			name:      "未指定 limit 时使用默认值",
+			query:     &DataSelectorQuery{PaginateQuery: &PaginateQuery{CursorMode: true}},
+			wantLimit: config.CursorPageLimit,
+		},
+		{
+			name:      "limit 超过上限时截断",
+			query:     &DataSelectorQuery{PaginateQuery: &PaginateQuery{CursorMode: true, Limit: config.CursorPageMaxLimit + 1}},
+			wantLimit: config.CursorPageMaxLimit,
+		},
+		{
+			name:         "游标解码为 continue token",
+			query:        &DataSelectorQuery{PaginateQuery: &PaginateQuery{CursorMode: true, Limit: 10, Cursor: encodeCursor("next-token")}},
+			wantLimit:    10,
+			wantContinue: "next-token",
+		},
+		{
+			name:    "游标不合法",
+			query:   &DataSelectorQuery{PaginateQuery: &PaginateQuery{CursorMode: true, Cursor: "!!!"}},
+			wantErr: true,
+		},
+		{
+			name:    "游标分页不支持排序",
+			query:   &DataSelectorQuery{SortQuery: &SortQuery{SortBy: "name"}, PaginateQuery: &PaginateQuery{CursorMode: true}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.query.compile(podAccessor.sortableFields()); err != nil {
+				t.Fatal(err)
+			}
+			opts, err := tt.query.cursorListOptions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cursorListOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (opts.Limit != tt.wantLimit || opts.Continue != tt.wantContinue) {
+				t.Errorf("cursorListOptions() limit = %d, continue = %q", opts.Limit, opts.Continue)
+			}
+		})
+	}
+}
+
+func TestDeploymentStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		replicas  int32
+		available int32
+		want      string
+	}{
+		{name: "全部可用", replicas: 3, available: 3, want: DeploymentAvailable},
+		{name: "部分可用", replicas: 3, available: 2, want: DeploymentUnavailable},
+		{name: "副本数为 0", replicas: 0, available: 0, want: DeploymentAvailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deploy := newTestDeployment("web", "default", tt.replicas)
+			deploy.Status = appsv1.DeploymentStatus{AvailableReplicas: tt.available}
+			if got := deploymentStatus(deploy); got != tt.want {
+				t.Errorf("deploymentStatus() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// sortTestPods 排序测试使用的 pod 列表
+func sortTestPods() []corev1.Pod {
+	newPod := func(name, namespace string, age time.Duration, restarts int32, cpu, memory string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         namespace,
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name: "main",
+					Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse(cpu),
+						corev1.ResourceMemory: resource.MustParse(memory),
+					}},
+				}},
+			},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{RestartCount: restarts}}},
+		}
+	}
+	return []corev1.Pod{
+		newPod("b", "default", 3*time.Hour, 2, "500m", "256Mi"),
+		newPod("a", "kube-system", 1*time.Hour, 0, "1", "128Mi"),
+		newPod("c", "default", 2*time.Hour, 5, "100m", "1Gi"),
+		newPod("d", "kube-system", 4*time.Hour, 2, "250m", "512Mi"),
+	}
+}
+
+func TestDataSelectorSort(t *testing.T) {
+	tests := []struct {
+		name      string
+		sortBy    string
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "默认按创建时间倒序", sortBy: "", wantNames: []string{"a", "c", "b", "d"}},
+		{name: "按名称升序", sortBy: "name", wantNames: []string{"a", "b", "c", "d"}},
+		{name: "按名称降序", sortBy: "-name", wantNames: []string{"d", "c", "b", "a"}},
+		{name: "按创建时间升序", sortBy: "creation", wantNames: []string{"d", "b", "c", "a"}},
+		{name: "多字段排序", sortBy: "-restarts,name", wantNames: []string{"c", "b", "d", "a"}},
+		{name: "命名空间相同时按 CPU 降序", sortBy: "namespace, -cpu", wantNames: []string{"b", "c", "a", "d"}},
+		{name: "按内存升序", sortBy: "+memory", wantNames: []string{"a", "b", "d", "c"}},
+		{name: "不支持的字段", sortBy: "name,foo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := &DataSelectorQuery{SortQuery: &SortQuery{SortBy: tt.sortBy}}
+			err := query.compile(podAccessor.sortableFields())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := NewSelector(sortTestPods(), query, podAccessor).Sort().Items()
+			for i := range got {
+				if got[i].Name != tt.wantNames[i] {
+					t.Errorf("Sort() items[%d] = %s, want %s", i, got[i].Name, tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDeploymentSortableFields(t *testing.T) {
+	query := &DataSelectorQuery{SortQuery: &SortQuery{SortBy: "restarts"}}
+	if err := query.compile(deploymentAccessor.sortableFields()); err == nil {
+		t.Errorf("deployment 不支持按 restarts 排序，compile() 应返回错误")
+	}
+
+	small := newTestDeployment("small", "default", 4)
+	small.Spec.Template.Spec.Containers[0].Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}
+	large := newTestDeployment("large", "default", 1)
+	large.Spec.Template.Spec.Containers[0].Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("300m")}
+	if got := deploymentAccessor.SortFields[SortByCPU](small); got != int64(400) {
+		t.Errorf("GetSortValue(cpu) = %v, want 400", got)
+	}
+	query = &DataSelectorQuery{SortQuery: &SortQuery{SortBy: "-cpu"}}
+	if err := query.compile(deploymentAccessor.sortableFields()); err != nil {
+		t.Fatal(err)
+	}
+	got := NewSelector([]appsv1.Deployment{*large, *small}, query, deploymentAccessor).Sort().Items()
+	if got[0].Name != "small" {
+		t.Errorf("按 CPU requests 总量降序时第一个应为 small, got %s", got[0].Name)
+	}
+}
+
+// 以下为泛型 Selector 之前基于 DataCell 接口的实现，仅用于基准测试对比
+// 每次查询都要将 []corev1.Pod 转为 []DataCell，排序时通过接口调用取值，返回前再断言回 corev1.Pod
+
+type legacyDataCell interface {
+	GetCreation() time.Time
+	GetName() string
+}
+
+type legacyPodCell corev1.Pod
+
+func (p legacyPodCell) GetCreation() time.Time { return p.CreationTimestamp.Time }
+
+func (p legacyPodCell) GetName() string { return p.Name }
+
+type legacyDataSelector struct {
+	GenericDataList []legacyDataCell
+	name            string
+	limit, page     int
+}
+
+func (d *legacyDataSelector) Len() int { return len(d.GenericDataList) }
+
+func (d *legacyDataSelector) Swap(i, j int) {
+	d.GenericDataList[i], d.GenericDataList[j] = d.GenericDataList[j], d.GenericDataList[i]
+}
+
+func (d *legacyDataSelector) Less(i, j int) bool {
+	return d.GenericDataList[j].GetCreation().Before(d.GenericDataList[i].GetCreation())
+}
+
+func (d *legacyDataSelector) run(pods []corev1.Pod) []corev1.Pod {
+	cells := make([]legacyDataCell, len(pods))
+	for i := range pods {
+		cells[i] = legacyPodCell(pods[i])
+	}
+	filtered := []legacyDataCell{}
+	for _, cell := range cells {
+		if strings.Contains(cell.GetName(), d.name) {
+			filtered = append(filtered, cell)
+		}
+	}
+	d.GenericDataList = filtered
+	sort.Sort(d)
+	start, end := d.limit*(d.page-1), d.limit*d.page
+	if end > len(d.GenericDataList) {
+		end = len(d.GenericDataList)
+	}
+	result := make([]corev1.Pod, 0, end-start)
+	for _, cell := range d.GenericDataList[start:end] {
+		result = append(result, corev1.Pod(cell.(legacyPodCell)))
+	}
+	return result
+}
+
+// benchmarkPods 生成 n 个创建时间乱序的 pod
+func benchmarkPods(n int) []corev1.Pod {
+	now := time.Now()
+	pods := make([]corev1.Pod, n)
+	for i := range pods {
+		pods[i] = corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              fmt.Sprintf("pod-%d", i),
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(now.Add(-time.Duration(i*7919%n) * time.Second)),
+				Labels:            map[string]string{"app": fmt.Sprintf("app-%d", i%10)},
+			},
+			Spec: corev1.PodSpec{
+				NodeName:   fmt.Sprintf("node-%d", i%50),
+				Containers: []corev1.Container{{Name: "main", Image: "nginx:1.25"}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	return pods
+}
+
+// 50000 个 pod，按名称过滤后按创建时间倒序排序，取第 3 页
+func BenchmarkSelector(b *testing.B) {
+	pods := benchmarkPods(50000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		query := &DataSelectorQuery{
+			FilterQuery:   &FilterQuery{Name: "pod-1"},
+			PaginateQuery: &PaginateQuery{Limit: 20, Page: 3},
+		}
+		if err := query.compile(podAccessor.sortableFields()); err != nil {
+			b.Fatal(err)
+		}
+		if got := NewSelector(pods, query, podAccessor).Filter().Sort().Paginate().Items(); len(got) != 20 {
+			b.Fatalf("got %d items", len(got))
+		}
+	}
+}
+
+func BenchmarkLegacyDataSelector(b *testing.B) {
+	pods := benchmarkPods(50000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		selector := &legacyDataSelector{name: "pod-1", limit: 20, page: 3}
+		if got := selector.run(pods); len(got) != 20 {
+			b.Fatalf("got %d items", len(got))
+		}
+	}
+}
+
+// 50000 个 pod，不过滤，按 命名空间、-重启次数、名称 多字段排序
+func BenchmarkSelectorMultiKeySort(b *testing.B) {
+	pods := benchmarkPods(50000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		query := &DataSelectorQuery{
+			SortQuery:     &SortQuery{SortBy: "namespace,-restarts,name"},
+			PaginateQuery: &PaginateQuery{Limit: 20, Page: 1},
+		}
+		if err := query.compile(podAccessor.sortableFields()); err != nil {
+			b.Fatal(err)
+		}
+		NewSelector(pods, query, podAccessor).Filter().Sort().Paginate().Items()
+	}
+}
@@ -5,29 +5,46 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/wonderivan/logger"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
+
+	"kubeadm-platform/config"
 )
 
 var Deployment deployment
 
 type deployment struct{}
 
-// DeploymentResp 定义列表的返回类型
+const (
+	// DeploymentAvailable 所有期望副本都可用
+	DeploymentAvailable = "available"
+	// DeploymentUnavailable 存在不可用的副本
+	DeploymentUnavailable = "unavailable"
+)
+
+// DeploymentResp 定义列表的返回类型，列表只返回摘要，完整对象通过详情接口获取
 type DeploymentResp struct {
-	Items []appsv1.Deployment `json:"items"`
+	Items []DeploymentSummary `json:"items"`
 	Total int                 `json:"total"`
+	// Cache 数据来源及新鲜度
+	Cache *CacheStatus `json:"cache"`
+	// Cursor 游标分页时下一页的游标，为空表示没有下一页
+	Cursor string `json:"cursor,omitempty"`
+	// Remaining 游标分页时 apiserver 估算的剩余数量（未计入内存过滤），apiserver 未返回时为空
+	Remaining *int64 `json:"remaining,omitempty"`
 }
 
 // DeployCreate 定义创建 Deployment 使用的结构体
+// 指定 Containers 时按其创建多个容器，否则使用 Image 等单容器字段创建一个与 Deployment 同名的容器
 type DeployCreate struct {
 	Name          string            `json:"name"`
 	Namespace     string            `json:"namespace"`
@@ -40,71 +57,159 @@ type DeployCreate struct {
 	HealthCheck   bool              `json:"health_check"`
 	HealthPath    string            `json:"health_path"`
 	Cluster       string            `json:"cluster"`
+	// Containers 容器列表，包括 sidecar
+	Containers []ContainerCreate `json:"containers"`
+	// InitContainers 按顺序在容器启动前运行
+	InitContainers []ContainerCreate `json:"init_containers"`
+	// Volumes pod 的卷，由容器的 VolumeMounts 挂载
+	Volumes []VolumeCreate `json:"volumes"`
+}
+
+// deploymentAccessor 定义 deployment 列表过滤、排序使用的字段
+var deploymentAccessor = &Accessor[appsv1.Deployment]{
+	Name:      func(d *appsv1.Deployment) string { return d.Name },
+	Creation:  func(d *appsv1.Deployment) time.Time { return d.CreationTimestamp.Time },
+	Namespace: func(d *appsv1.Deployment) string { return d.Namespace },
+	Labels:    func(d *appsv1.Deployment) map[string]string { return d.Labels },
+	Fields: func(d *appsv1.Deployment) fields.Set {
+		return fields.Set{
+			"metadata.name":      d.Name,
+			"metadata.namespace": d.Namespace,
+		}
+	},
+	Status: deploymentStatus,
+	Images: func(d *appsv1.Deployment) []string { return containerImages(&d.Spec.Template.Spec) },
+	// CPU 和内存为所有期望副本的 requests 之和
+	SortFields: map[string]func(*appsv1.Deployment) interface{}{
+		SortByName:      func(d *appsv1.Deployment) interface{} { return d.Name },
+		SortByCreation:  func(d *appsv1.Deployment) interface{} { return d.CreationTimestamp.Time },
+		SortByNamespace: func(d *appsv1.Deployment) interface{} { return d.Namespace },
+		SortByReady:     func(d *appsv1.Deployment) interface{} { return int64(d.Status.ReadyReplicas) },
+		SortByCPU: func(d *appsv1.Deployment) interface{} {
+			return sumRequests(d.Spec.Template.Spec.Containers, corev1.ResourceCPU) * int64(desiredReplicas(d))
+		},
+		SortByMemory: func(d *appsv1.Deployment) interface{} {
+			return sumRequests(d.Spec.Template.Spec.Containers, corev1.ResourceMemory) * int64(desiredReplicas(d))
+		},
+	},
 }
 
-// 从 deployment 类型转到 DataCell 类型
-func (d *deployment) toCells(std []appsv1.Deployment) []DataCell {
-	cells := make([]DataCell, len(std))
-	for i := range std {
-		cells[i] = deploymentCell(std[i])
+// desiredReplicas 返回期望副本数，未设置时与 apiserver 默认值一致为 1
+func desiredReplicas(d *appsv1.Deployment) int32 {
+	if d.Spec.Replicas != nil {
+		return *d.Spec.Replicas
 	}
-	return cells
+	return 1
 }
 
-// 从 DataCell 类型转到 deployment 类型
-func (d *deployment) fromCells(cells []DataCell) []appsv1.Deployment {
-	pods := make([]appsv1.Deployment, len(cells))
-	for i := range cells {
-		pods[i] = appsv1.Deployment(cells[i].(deploymentCell))
+// deploymentStatus 所有期望副本都可用时为 available，否则为 unavailable
+func deploymentStatus(d *appsv1.Deployment) string {
+	if d.Status.AvailableReplicas >= desiredReplicas(d) {
+		return DeploymentAvailable
 	}
-	return pods
+	return DeploymentUnavailable
 }
 
-// GetDeployments 获取 deployment 列表
-func (d *deployment) GetDeployments(client *kubernetes.Clientset, filterName, namespace string, limit, page int) (deploymentResp *DeploymentResp, err error) {
-	deploymentList, err := client.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+// listDeployments 获取 deployment 列表，useCache 为 true 时优先读取 informer 缓存，缓存不可用时回退到 apiserver
+// 访问 apiserver 时将标签和字段选择器下推到 ListOptions，缓存数据由 Selector 在内存中过滤
+func (d *deployment) listDeployments(client kubernetes.Interface, namespace string, filter *FilterQuery, useCache bool) ([]appsv1.Deployment, *CacheStatus, error) {
+	if useCache && config.InformerCacheEnabled {
+		objs, status, err := Cache.List(client, cacheResourceDeployments, namespace)
+		if err == nil {
+			deployments := make([]appsv1.Deployment, len(objs))
+			for i := range objs {
+				deployments[i] = *objs[i].(*appsv1.Deployment)
+			}
+			return deployments, status, nil
+		}
+		logger.Warn(fmt.Sprintf("读取Deployment缓存失败，回退到apiserver, %v", err))
+	}
+	deploymentList, err := client.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: filter.LabelSelector,
+		FieldSelector: filter.FieldSelector,
+	})
 	if err != nil {
+		return nil, nil, err
+	}
+	return deploymentList.Items, apiServerStatus, nil
+}
+
+// GetDeployments 获取 deployment 列表
+func (d *deployment) GetDeployments(client kubernetes.Interface, namespace string, query *DataSelectorQuery, useCache bool) (deploymentResp *DeploymentResp, err error) {
+	// 先校验查询条件再访问 apiserver
+	if err = query.compile(deploymentAccessor.sortableFields()); err != nil {
 		logger.Error(fmt.Sprintf("获取Deployment列表失败, %v", err))
 		return nil, errors.New(fmt.Sprintf("获取Deployment列表失败, %v", err))
 	}
-	//实例化dataSelector对象
-	selectableData := &dataSelector{
-		GenericDataList: d.toCells(deploymentList.Items),
-		dataSelectorQuery: &DataSelectorQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
-			PaginateQuery: &PaginateQuery{
-				Limit: limit,
-				Page:  page,
-			},
-		},
+	if query.PaginateQuery.CursorMode {
+		return d.getDeploymentsByCursor(client, namespace, query)
+	}
+	deploymentList, status, err := d.listDeployments(client, namespace, query.FilterQuery, useCache)
+	if err != nil {
+		logger.Error(fmt.Sprintf("获取Deployment列表失败, %v", err))
+		return nil, errors.New(fmt.Sprintf("获取Deployment列表失败, %v", err))
 	}
-	// 先过滤
-	filtered := selectableData.Filter()
-	total := len(filtered.GenericDataList)
+	// 实例化 Selector 对象，先过滤
+	filtered := NewSelector(deploymentList, query, deploymentAccessor).Filter()
+	total := filtered.Len()
 	// 再排序和分页
-	data := filtered.Sort().Paginate()
-
-	deployments := d.fromCells(data.GenericDataList)
+	deployments := filtered.Sort().Paginate().Items()
 
 	return &DeploymentResp{
-		Items: deployments,
+		Items: toDeploymentSummaries(deployments),
 		Total: total,
+		Cache: status,
 	}, nil
 }
 
-// GetDeploymentDetail 获取 deployment 详情
-func (d *deployment) GetDeploymentDetail(client *kubernetes.Clientset, deploymentName, namespace string) (deployment *appsv1.Deployment, err error) {
+// getDeploymentsByCursor 使用 apiserver 的 limit/continue 游标分页获取 deployment 列表，不读取缓存
+// 名称等无法下推的过滤条件只在当前页内生效，因此一页的数量可能少于 limit
+func (d *deployment) getDeploymentsByCursor(client kubernetes.Interface, namespace string, query *DataSelectorQuery) (*DeploymentResp, error) {
+	opts, err := query.cursorListOptions()
+	if err != nil {
+		logger.Error(fmt.Sprintf("获取Deployment列表失败, %v", err))
+		return nil, errors.New(fmt.Sprintf("获取Deployment列表失败, %v", err))
+	}
+	list, err := client.AppsV1().Deployments(namespace).List(context.TODO(), opts)
+	if err != nil {
+		err = cursorListError(err)
+		logger.Error(fmt.Sprintf("获取Deployment列表失败, %v", err))
+		return nil, errors.New(fmt.Sprintf("获取Deployment列表失败, %v", err))
+	}
+	items := NewSelector(list.Items, query, deploymentAccessor).Filter().Items()
+	return &DeploymentResp{
+		Items:     toDeploymentSummaries(items),
+		Total:     len(items),
+		Cache:     apiServerStatus,
+		Cursor:    encodeCursor(list.Continue),
+		Remaining: list.RemainingItemCount,
+	}, nil
+}
+
+// GetDeploymentDetail 获取 deployment 详情，useCache 为 true 时优先读取 informer 缓存
+func (d *deployment) GetDeploymentDetail(client kubernetes.Interface, deploymentName, namespace string, useCache bool) (deployment *appsv1.Deployment, status *CacheStatus, err error) {
+	if useCache && config.InformerCacheEnabled {
+		obj, status, err := Cache.Get(client, cacheResourceDeployments, namespace, deploymentName)
+		if err == nil {
+			return obj.(*appsv1.Deployment).DeepCopy(), status, nil
+		}
+		if apierrors.IsNotFound(err) {
+			logger.Error(fmt.Sprintf("获取Deployment详情失败, %v", err))
+			return nil, nil, errors.New(fmt.Sprintf("获取Deployment详情失败, %v", err))
+		}
+		logger.Warn(fmt.Sprintf("读取Deployment缓存失败，回退到apiserver, %v", err))
+	}
 	deployment, err = client.AppsV1().Deployments(namespace).Get(context.TODO(), deploymentName, metav1.GetOptions{})
 	if err != nil {
 		logger.Error(fmt.Sprintf("获取Deployment详情失败, %v", err))
-		return nil, errors.New(fmt.Sprintf("获取Deployment详情失败, %v", err))
+		return nil, nil, errors.New(fmt.Sprintf("获取Deployment详情失败, %v", err))
 	}
 
-	return deployment, nil
+	return deployment, apiServerStatus, nil
 }
 
 // UpdateDeployment 更新 deployment
-func (d *deployment) UpdateDeployment(client *kubernetes.Clientset, namespace, content string) (err error) {
+func (d *deployment) UpdateDeployment(client kubernetes.Interface, namespace, content string) (err error) {
 	var deploy = &appsv1.Deployment{}
 
 	err = json.Unmarshal([]byte(content), deploy)
@@ -122,7 +227,7 @@ func (d *deployment) UpdateDeployment(client *kubernetes.Clientset, namespace, c
 }
 
 // DeleteDeployment 删除 deployment
-func (d *deployment) DeleteDeployment(client *kubernetes.Clientset, deploymentName, namespace string) (err error) {
+func (d *deployment) DeleteDeployment(client kubernetes.Interface, deploymentName, namespace string) (err error) {
 	err = client.AppsV1().Deployments(namespace).Delete(context.TODO(), deploymentName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(fmt.Sprintf("删除Deployment失败, %v", err))
@@ -133,7 +238,7 @@ func (d *deployment) DeleteDeployment(client *kubernetes.Clientset, deploymentNa
 }
 
 // ScaleDeployment 修改 Deployment 副本数
-func (d *deployment) ScaleDeployment(client *kubernetes.Clientset, deploymentName, namespace string, scaleNum int) (replica int32, err error) {
+func (d *deployment) ScaleDeployment(client kubernetes.Interface, deploymentName, namespace string, scaleNum int) (replica int32, err error) {
 	//获取 aotuscalingv1.Scale 类型的对象，能点出当前的副本数
 	scale, err := client.AppsV1().Deployments(namespace).GetScale(context.TODO(), deploymentName, metav1.GetOptions{})
 	if err != nil {
@@ -151,32 +256,35 @@ func (d *deployment) ScaleDeployment(client *kubernetes.Clientset, deploymentNam
 	return newScale.Spec.Replicas, nil
 }
 
-// RestartDeployment 重启 Deployment
-func (d *deployment) RestartDeployment(client *kubernetes.Clientset, deploymentName, namespace string) (err error) {
-	// 通过 patch 方法实现重启
-	// 此功能等同于 kubectl 命令
-	// kubectl deployment ${service} -p \
-	// '{"spec":{"template":{"spec":{"containers":[{"name":"'"${service}"'","env":[{"name":"RESTART_","value":"'$(date +%s)'"}]}]}}}}'
+// restartedAtAnnotation kubectl rollout restart 使用的 pod 模板注解
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
 
-	// 使用 patchData Map 组装数据
-	patchData := map[string]interface{}{
+// restartPatch 生成重启工作负载的 strategic merge patch，与 kubectl rollout restart 相同
+// 通过修改 pod 模板的注解触发滚动更新，不依赖容器名，适用于 Deployment、StatefulSet、DaemonSet
+func restartPatch() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
 		"spec": map[string]interface{}{
 			"template": map[string]interface{}{
-				"spec": map[string]interface{}{
-					"containers": []map[string]interface{}{
-						{"name": deploymentName,
-							"env": []map[string]string{{
-								"name":  "RESTART_",
-								"value": strconv.FormatInt(time.Now().Unix(), 10),
-							}},
-						},
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{
+						restartedAtAnnotation: time.Now().Format(time.RFC3339),
 					},
 				},
 			},
 		},
+	})
+}
+
+// RestartDeployment 重启 Deployment，暂停状态的 Deployment 需先恢复
+func (d *deployment) RestartDeployment(client kubernetes.Interface, deploymentName, namespace string) (err error) {
+	deployment, _, err := d.GetDeploymentDetail(client, deploymentName, namespace, false)
+	if err != nil {
+		return err
 	}
-	// 序列化成 json
-	patchByte, err := json.Marshal(patchData)
+	if deployment.Spec.Paused {
+		return errors.New(fmt.Sprintf("Deployment:%s已暂停，请先恢复再重启", deploymentName))
+	}
+	patchByte, err := restartPatch()
 	if err != nil {
 		logger.Error(fmt.Sprintf("序列化失败, %v", err))
 		return errors.New(fmt.Sprintf("序列化失败, %v", err))
@@ -191,8 +299,123 @@ func (d *deployment) RestartDeployment(client *kubernetes.Clientset, deploymentN
 	return nil
 }
 
+// SetImage 更新 Deployment 中指定容器的镜像，images 的 key 为容器名（包括 init 容器），value 为镜像
+// 通过 strategic merge patch 只修改镜像字段，并记录 change-cause 注解，changeCause 为空时根据修改内容生成
+func (d *deployment) SetImage(client kubernetes.Interface, deploymentName, namespace string, images map[string]string, changeCause string) (err error) {
+	if len(images) == 0 {
+		return errors.New("请指定要更新的容器和镜像")
+	}
+	deployment, _, err := d.GetDeploymentDetail(client, deploymentName, namespace, false)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(images))
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	spec := deployment.Spec.Template.Spec
+	var containers, initContainers []map[string]string
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		image := images[name]
+		if image == "" {
+			return errors.New(fmt.Sprintf("容器:%s的镜像不能为空", name))
+		}
+		switch {
+		case containsContainer(spec.Containers, name):
+			containers = append(containers, map[string]string{"name": name, "image": image})
+		case containsContainer(spec.InitContainers, name):
+			initContainers = append(initContainers, map[string]string{"name": name, "image": image})
+		default:
+			return errors.New(fmt.Sprintf("容器:%s在Deployment:%s中不存在", name, deploymentName))
+		}
+		pairs = append(pairs, name+"="+image)
+	}
+	if changeCause == "" {
+		changeCause = "set image " + strings.Join(pairs, " ")
+	}
+
+	// 容器列表按 name 合并，未指定的容器和字段保持不变
+	podSpec := map[string]interface{}{}
+	if len(containers) > 0 {
+		podSpec["containers"] = containers
+	}
+	if len(initContainers) > 0 {
+		podSpec["initContainers"] = initContainers
+	}
+	patchByte, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{changeCauseAnnotation: changeCause},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": podSpec,
+			},
+		},
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("序列化失败, %v", err))
+		return errors.New(fmt.Sprintf("序列化失败, %v", err))
+	}
+	_, err = client.AppsV1().Deployments(namespace).Patch(context.TODO(), deploymentName,
+		"application/strategic-merge-patch+json", patchByte, metav1.PatchOptions{})
+	if err != nil {
+		logger.Error(fmt.Sprintf("更新Deployment镜像失败, %v", err))
+		return errors.New(fmt.Sprintf("更新Deployment镜像失败, %v", err))
+	}
+	return nil
+}
+
+// PauseDeployment 暂停 Deployment 的发布，暂停期间修改 pod 模板不会触发发布，恢复后合并为一次发布
+func (d *deployment) PauseDeployment(client kubernetes.Interface, deploymentName, namespace string) (err error) {
+	return d.setPaused(client, deploymentName, namespace, true)
+}
+
+// ResumeDeployment 恢复 Deployment 的发布
+func (d *deployment) ResumeDeployment(client kubernetes.Interface, deploymentName, namespace string) (err error) {
+	return d.setPaused(client, deploymentName, namespace, false)
+}
+
+// setPaused 通过 patch spec.paused 暂停或恢复发布，与 kubectl rollout pause/resume 相同
+func (d *deployment) setPaused(client kubernetes.Interface, deploymentName, namespace string, paused bool) error {
+	action := "恢复"
+	if paused {
+		action = "暂停"
+	}
+	deployment, _, err := d.GetDeploymentDetail(client, deploymentName, namespace, false)
+	if err != nil {
+		return err
+	}
+	if deployment.Spec.Paused == paused {
+		return errors.New(fmt.Sprintf("Deployment:%s已处于%s状态", deploymentName, action))
+	}
+	patchByte, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"paused": paused,
+		},
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("序列化失败, %v", err))
+		return errors.New(fmt.Sprintf("序列化失败, %v", err))
+	}
+	_, err = client.AppsV1().Deployments(namespace).Patch(context.TODO(), deploymentName,
+		"application/strategic-merge-patch+json", patchByte, metav1.PatchOptions{})
+	if err != nil {
+		logger.Error(fmt.Sprintf("%sDeployment失败, %v", action, err))
+		return errors.New(fmt.Sprintf("%sDeployment失败, %v", action, err))
+	}
+	return nil
+}
+
 // CreateDeployment 创建 Deployment
-func (d *deployment) CreateDeployment(client *kubernetes.Clientset, data *DeployCreate) (err error) {
+func (d *deployment) CreateDeployment(client kubernetes.Interface, data *DeployCreate) (err error) {
+	// 校验容器定义并组装 pod spec
+	podSpec, err := buildPodSpec(data)
+	if err != nil {
+		logger.Error(fmt.Sprintf("创建Deployment失败, %v\n", err))
+		return errors.New(fmt.Sprintf("创建Deployment失败, %v\n", err))
+	}
 	// 将 data 中的属性组装成 appsv1.Deployment 对象
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -210,79 +433,11 @@ func (d *deployment) CreateDeployment(client *kubernetes.Clientset, data *Deploy
 					Name:   data.Name,
 					Labels: data.Label,
 				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  data.Name,
-							Image: data.Image,
-							Ports: []corev1.ContainerPort{
-								{
-									Name:          "http",
-									Protocol:      corev1.ProtocolTCP,
-									ContainerPort: 80,
-								},
-							},
-						},
-					},
-				},
+				Spec: *podSpec,
 			},
 		},
 		Status: appsv1.DeploymentStatus{},
 	}
-	// 判断是否打开健康检查功能，若打开，则定义 ReadinessProbe 和 LivenessProbe
-	if data.HealthCheck {
-		deployment.Spec.Template.Spec.Containers[0].ReadinessProbe = &corev1.Probe{
-			ProbeHandler: corev1.ProbeHandler{
-				HTTPGet: &corev1.HTTPGetAction{
-					Path: data.HealthPath,
-					// intstr.IntOrString 的作用是端口可以定义为整行，也可以定义为字符串
-					// type=0 表示整行，使用 intVal
-					// type=1 表示字符串，使用 strVal
-					Port: intstr.IntOrString{
-						Type:   0,
-						IntVal: data.ContainerPort,
-					},
-				},
-			},
-			// 初始化等待时间
-			InitialDelaySeconds: 5,
-			// 超时时间
-			TimeoutSeconds: 15,
-			// 执行间隔
-			PeriodSeconds: 5,
-		}
-		deployment.Spec.Template.Spec.Containers[0].LivenessProbe = &corev1.Probe{
-			ProbeHandler: corev1.ProbeHandler{
-				HTTPGet: &corev1.HTTPGetAction{
-					Path: data.HealthPath,
-					// intstr.IntOrString 的作用是端口可以定义为整行，也可以定义为字符串
-					// type=0 表示整行，使用 intVal
-					// type=1 表示字符串，使用 strVal
-					Port: intstr.IntOrString{
-						Type:   0,
-						IntVal: data.ContainerPort,
-					},
-				},
-			},
-			// 初始化等待时间
-			InitialDelaySeconds: 15,
-			// 超时时间
-			TimeoutSeconds: 15,
-			// 执行间隔
-			PeriodSeconds: 5,
-		}
-	}
-	// 定义容器的 limit 和 request 资源
-	deployment.Spec.Template.Spec.Containers[0].Resources.Limits =
-		map[corev1.ResourceName]resource.Quantity{
-			corev1.ResourceCPU:    resource.MustParse(data.Cpu),
-			corev1.ResourceMemory: resource.MustParse(data.Memory),
-		}
-	deployment.Spec.Template.Spec.Containers[0].Resources.Requests =
-		map[corev1.ResourceName]resource.Quantity{
-			corev1.ResourceCPU:    resource.MustParse(data.Cpu),
-			corev1.ResourceMemory: resource.MustParse(data.Memory),
-		}
 	//创建 deployment
 	_, err = client.AppsV1().Deployments(data.Namespace).Create(context.TODO(), deployment, metav1.CreateOptions{})
 	if err != nil {
@@ -0,0 +1,506 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// 探针类型
+const (
+	ProbeHTTP = "http"
+	ProbeTCP  = "tcp"
+	ProbeExec = "exec"
+)
+
+// ContainerCreate 定义创建 Deployment 时的一个容器
+type ContainerCreate struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	// Command、Args 为空时使用镜像默认的 ENTRYPOINT 和 CMD
+	Command []string              `json:"command"`
+	Args    []string              `json:"args"`
+	Ports   []ContainerPortCreate `json:"ports"`
+	// Cpu、Memory 为 requests，CpuLimit、MemoryLimit 为 limits，为空时不设置
+	Cpu            string       `json:"cpu"`
+	Memory         string       `json:"memory"`
+	CpuLimit       string       `json:"cpu_limit"`
+	MemoryLimit    string       `json:"memory_limit"`
+	ReadinessProbe *ProbeCreate `json:"readiness_probe"`
+	LivenessProbe  *ProbeCreate `json:"liveness_probe"`
+	StartupProbe   *ProbeCreate `json:"startup_probe"`
+	Env            []EnvCreate  `json:"env"`
+	// EnvFrom 中的环境变量会被 Env 中的同名变量覆盖
+	EnvFrom      []EnvFromCreate     `json:"env_from"`
+	VolumeMounts []VolumeMountCreate `json:"volume_mounts"`
+}
+
+// 卷类型
+const (
+	VolumeConfigMap = "configMap"
+	VolumeSecret    = "secret"
+	VolumeEmptyDir  = "emptyDir"
+	VolumePVC       = "pvc"
+)
+
+// EnvCreate 定义环境变量，Value 与各种引用只能设置一个
+type EnvCreate struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// ConfigMapKeyRef、SecretKeyRef 引用 ConfigMap、Secret 中的一个 key
+	ConfigMapKeyRef *KeyRefCreate `json:"config_map_key_ref"`
+	SecretKeyRef    *KeyRefCreate `json:"secret_key_ref"`
+	// FieldRef 引用 pod 的字段，如 metadata.name、status.podIP
+	FieldRef string `json:"field_ref"`
+}
+
+// KeyRefCreate 引用 ConfigMap 或 Secret 中的一个 key
+type KeyRefCreate struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// Optional 为 true 时 ConfigMap、Secret 或 key 不存在也能启动容器
+	Optional bool `json:"optional"`
+}
+
+// EnvFromCreate 将 ConfigMap 或 Secret 的所有 key 作为环境变量，ConfigMap 与 Secret 只能设置一个
+type EnvFromCreate struct {
+	ConfigMap string `json:"config_map"`
+	Secret    string `json:"secret"`
+	// Prefix 添加在每个环境变量名前的前缀
+	Prefix   string `json:"prefix"`
+	Optional bool   `json:"optional"`
+}
+
+// VolumeCreate 定义 pod 的卷
+type VolumeCreate struct {
+	Name string `json:"name"`
+	// Type 卷类型，configMap、secret、emptyDir、pvc
+	Type string `json:"type"`
+	// Source ConfigMap、Secret 或 PVC 的名称
+	Source string `json:"source"`
+	// Medium emptyDir 的存储介质，为 Memory 时使用 tmpfs
+	Medium string `json:"medium"`
+	// SizeLimit emptyDir 的容量上限，如 1Gi
+	SizeLimit string `json:"size_limit"`
+	// ReadOnly 以只读方式使用 PVC
+	ReadOnly bool `json:"read_only"`
+}
+
+// VolumeMountCreate 定义容器的挂载点
+type VolumeMountCreate struct {
+	// Name 挂载的卷名，必须在 DeployCreate.Volumes 中定义
+	Name      string `json:"name"`
+	MountPath string `json:"mount_path"`
+	// SubPath 只挂载卷中的子路径，必须为相对路径
+	SubPath  string `json:"sub_path"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// ContainerPortCreate 定义容器端口
+type ContainerPortCreate struct {
+	Name          string `json:"name"`
+	ContainerPort int32  `json:"container_port"`
+	// Protocol 为空时使用 TCP
+	Protocol string `json:"protocol"`
+}
+
+// ProbeCreate 定义容器探针，时间参数为 0 时使用 kubernetes 默认值
+type ProbeCreate struct {
+	// Type 探测方式，http、tcp、exec
+	Type string `json:"type"`
+	// Path http 探测的路径
+	Path string `json:"path"`
+	// Port http、tcp 探测的端口，为 0 时使用容器的第一个端口
+	Port int32 `json:"port"`
+	// Command exec 探测执行的命令
+	Command             []string `json:"command"`
+	InitialDelaySeconds int32    `json:"initial_delay_seconds"`
+	TimeoutSeconds      int32    `json:"timeout_seconds"`
+	PeriodSeconds       int32    `json:"period_seconds"`
+	FailureThreshold    int32    `json:"failure_threshold"`
+}
+
+// legacyContainer 将 DeployCreate 中单容器的字段转换为容器定义，容器与 Deployment 同名
+// Deployment 名允许包含 . 而容器名不允许，容器名中的 . 替换为 -
+// cpu、memory 同时作为 requests 和 limits，开启健康检查时在容器端口上做 http 探测
+func legacyContainer(data *DeployCreate) ContainerCreate {
+	container := ContainerCreate{
+		Name:        strings.ReplaceAll(data.Name, ".", "-"),
+		Image:       data.Image,
+		Cpu:         data.Cpu,
+		Memory:      data.Memory,
+		CpuLimit:    data.Cpu,
+		MemoryLimit: data.Memory,
+	}
+	if data.ContainerPort != 0 {
+		container.Ports = []ContainerPortCreate{{Name: "http", ContainerPort: data.ContainerPort}}
+	}
+	if data.HealthCheck {
+		container.ReadinessProbe = &ProbeCreate{
+			Type: ProbeHTTP, Path: data.HealthPath, Port: data.ContainerPort,
+			InitialDelaySeconds: 5, TimeoutSeconds: 15, PeriodSeconds: 5,
+		}
+		container.LivenessProbe = &ProbeCreate{
+			Type: ProbeHTTP, Path: data.HealthPath, Port: data.ContainerPort,
+			InitialDelaySeconds: 15, TimeoutSeconds: 15, PeriodSeconds: 5,
+		}
+	}
+	return container
+}
+
+// buildPodSpec 校验 DeployCreate 中的容器定义并组装 pod spec
+// 未指定 Containers 时使用单容器的字段
+func buildPodSpec(data *DeployCreate) (*corev1.PodSpec, error) {
+	containers := data.Containers
+	if len(containers) == 0 {
+		containers = []ContainerCreate{legacyContainer(data)}
+	}
+	spec := &corev1.PodSpec{}
+	volumes := make(map[string]bool)
+	for _, v := range data.Volumes {
+		volume, err := buildVolume(v)
+		if err != nil {
+			return nil, err
+		}
+		if volumes[v.Name] {
+			return nil, errors.New(fmt.Sprintf("卷名:%s重复", v.Name))
+		}
+		volumes[v.Name] = true
+		spec.Volumes = append(spec.Volumes, *volume)
+	}
+	names := make(map[string]bool)
+	for i := range data.InitContainers {
+		container, err := buildContainer(&data.InitContainers[i], names, volumes, true)
+		if err != nil {
+			return nil, err
+		}
+		spec.InitContainers = append(spec.InitContainers, *container)
+	}
+	for i := range containers {
+		container, err := buildContainer(&containers[i], names, volumes, false)
+		if err != nil {
+			return nil, err
+		}
+		spec.Containers = append(spec.Containers, *container)
+	}
+	return spec, nil
+}
+
+// buildContainer 校验并组装一个容器，names 记录已使用的容器名，volumes 为 pod 中定义的卷
+// init 容器不能设置探针
+func buildContainer(c *ContainerCreate, names, volumes map[string]bool, init bool) (*corev1.Container, error) {
+	if errs := validation.IsDNS1123Label(c.Name); len(errs) > 0 {
+		return nil, errors.New(fmt.Sprintf("容器名:%q不合法, %s", c.Name, strings.Join(errs, "; ")))
+	}
+	if names[c.Name] {
+		return nil, errors.New(fmt.Sprintf("容器名:%s重复", c.Name))
+	}
+	names[c.Name] = true
+	if c.Image == "" {
+		return nil, errors.New(fmt.Sprintf("容器:%s的镜像不能为空", c.Name))
+	}
+	if init && (c.ReadinessProbe != nil || c.LivenessProbe != nil || c.StartupProbe != nil) {
+		return nil, errors.New(fmt.Sprintf("init容器:%s不能设置探针", c.Name))
+	}
+
+	container := &corev1.Container{
+		Name:    c.Name,
+		Image:   c.Image,
+		Command: c.Command,
+		Args:    c.Args,
+	}
+	for _, p := range c.Ports {
+		port, err := buildContainerPort(c.Name, p)
+		if err != nil {
+			return nil, err
+		}
+		container.Ports = append(container.Ports, port)
+	}
+	var err error
+	if container.Resources.Requests, err = buildResourceList(c.Name, c.Cpu, c.Memory); err != nil {
+		return nil, err
+	}
+	if container.Resources.Limits, err = buildResourceList(c.Name, c.CpuLimit, c.MemoryLimit); err != nil {
+		return nil, err
+	}
+	if container.ReadinessProbe, err = buildProbe(c, c.ReadinessProbe); err != nil {
+		return nil, err
+	}
+	if container.LivenessProbe, err = buildProbe(c, c.LivenessProbe); err != nil {
+		return nil, err
+	}
+	if container.StartupProbe, err = buildProbe(c, c.StartupProbe); err != nil {
+		return nil, err
+	}
+	if container.Env, err = buildEnv(c.Name, c.Env); err != nil {
+		return nil, err
+	}
+	for _, e := range c.EnvFrom {
+		envFrom, err := buildEnvFrom(c.Name, e)
+		if err != nil {
+			return nil, err
+		}
+		container.EnvFrom = append(container.EnvFrom, envFrom)
+	}
+	if container.VolumeMounts, err = buildVolumeMounts(c.Name, c.VolumeMounts, volumes); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
+
+func buildContainerPort(containerName string, p ContainerPortCreate) (corev1.ContainerPort, error) {
+	if p.ContainerPort <= 0 || p.ContainerPort > 65535 {
+		return corev1.ContainerPort{}, errors.New(fmt.Sprintf("容器:%s的端口:%d不合法", containerName, p.ContainerPort))
+	}
+	protocol := corev1.Protocol(strings.ToUpper(p.Protocol))
+	switch protocol {
+	case "":
+		protocol = corev1.ProtocolTCP
+	case corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+	default:
+		return corev1.ContainerPort{}, errors.New(fmt.Sprintf("容器:%s的端口协议:%s不合法，可选 TCP、UDP、SCTP", containerName, p.Protocol))
+	}
+	return corev1.ContainerPort{Name: p.Name, ContainerPort: p.ContainerPort, Protocol: protocol}, nil
+}
+
+// buildResourceList 解析 cpu、memory，为空的不设置，都为空时返回 nil
+func buildResourceList(containerName, cpu, memory string) (corev1.ResourceList, error) {
+	var list corev1.ResourceList
+	for name, value := range map[corev1.ResourceName]string{corev1.ResourceCPU: cpu, corev1.ResourceMemory: memory} {
+		if value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("容器:%s的%s:%s不合法, %v", containerName, name, value, err))
+		}
+		if list == nil {
+			list = corev1.ResourceList{}
+		}
+		list[name] = quantity
+	}
+	return list, nil
+}
+
+// buildProbe 组装探针，http、tcp 探测未指定端口时使用容器的第一个端口
+func buildProbe(c *ContainerCreate, p *ProbeCreate) (*corev1.Probe, error) {
+	if p == nil {
+		return nil, nil
+	}
+	port := p.Port
+	if port == 0 && len(c.Ports) > 0 {
+		port = c.Ports[0].ContainerPort
+	}
+	probe := &corev1.Probe{
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		FailureThreshold:    p.FailureThreshold,
+	}
+	switch p.Type {
+	case ProbeHTTP, ProbeTCP:
+		if port <= 0 || port > 65535 {
+			return nil, errors.New(fmt.Sprintf("容器:%s的%s探针端口:%d不合法", c.Name, p.Type, port))
+		}
+		if p.Type == ProbeHTTP {
+			probe.HTTPGet = &corev1.HTTPGetAction{Path: p.Path, Port: intstr.FromInt(int(port))}
+		} else {
+			probe.TCPSocket = &corev1.TCPSocketAction{Port: intstr.FromInt(int(port))}
+		}
+	case ProbeExec:
+		if len(p.Command) == 0 {
+			return nil, errors.New(fmt.Sprintf("容器:%s的exec探针命令不能为空", c.Name))
+		}
+		probe.Exec = &corev1.ExecAction{Command: p.Command}
+	default:
+		return nil, errors.New(fmt.Sprintf("容器:%s的探针类型:%s不合法，可选 http、tcp、exec", c.Name, p.Type))
+	}
+	return probe, nil
+}
+
+// envFieldPaths 环境变量可以引用的 pod 字段，metadata.labels、metadata.annotations 需指定 key
+var envFieldPaths = map[string]bool{
+	"metadata.name":           true,
+	"metadata.namespace":      true,
+	"metadata.uid":            true,
+	"spec.nodeName":           true,
+	"spec.serviceAccountName": true,
+	"status.hostIP":           true,
+	"status.podIP":            true,
+	"status.podIPs":           true,
+}
+
+// validFieldPath 判断是否为可以引用的 pod 字段，如 metadata.labels['app']
+func validFieldPath(fieldPath string) bool {
+	for _, prefix := range []string{"metadata.labels['", "metadata.annotations['"} {
+		if strings.HasPrefix(fieldPath, prefix) && strings.HasSuffix(fieldPath, "']") {
+			return len(fieldPath) > len(prefix)+2
+		}
+	}
+	return envFieldPaths[fieldPath]
+}
+
+// buildEnv 校验并组装环境变量，变量名不能重复
+func buildEnv(containerName string, envs []EnvCreate) ([]corev1.EnvVar, error) {
+	var result []corev1.EnvVar
+	seen := make(map[string]bool)
+	for _, e := range envs {
+		if errs := validation.IsEnvVarName(e.Name); len(errs) > 0 {
+			return nil, errors.New(fmt.Sprintf("容器:%s的环境变量名:%q不合法, %s", containerName, e.Name, strings.Join(errs, "; ")))
+		}
+		if seen[e.Name] {
+			return nil, errors.New(fmt.Sprintf("容器:%s的环境变量:%s重复", containerName, e.Name))
+		}
+		seen[e.Name] = true
+
+		env := corev1.EnvVar{Name: e.Name, Value: e.Value}
+		sources := 0
+		if e.ConfigMapKeyRef != nil {
+			sources++
+			if err := validateKeyRef(containerName, e.Name, e.ConfigMapKeyRef); err != nil {
+				return nil, err
+			}
+			env.ValueFrom = &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: e.ConfigMapKeyRef.Name},
+				Key:                  e.ConfigMapKeyRef.Key,
+				Optional:             &e.ConfigMapKeyRef.Optional,
+			}}
+		}
+		if e.SecretKeyRef != nil {
+			sources++
+			if err := validateKeyRef(containerName, e.Name, e.SecretKeyRef); err != nil {
+				return nil, err
+			}
+			env.ValueFrom = &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: e.SecretKeyRef.Name},
+				Key:                  e.SecretKeyRef.Key,
+				Optional:             &e.SecretKeyRef.Optional,
+			}}
+		}
+		if e.FieldRef != "" {
+			sources++
+			if !validFieldPath(e.FieldRef) {
+				return nil, errors.New(fmt.Sprintf("容器:%s的环境变量:%s引用的字段:%s不支持", containerName, e.Name, e.FieldRef))
+			}
+			env.ValueFrom = &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: e.FieldRef}}
+		}
+		if sources > 1 || (sources == 1 && e.Value != "") {
+			return nil, errors.New(fmt.Sprintf("容器:%s的环境变量:%s只能设置value、config_map_key_ref、secret_key_ref、field_ref中的一个", containerName, e.Name))
+		}
+		result = append(result, env)
+	}
+	return result, nil
+}
+
+func validateKeyRef(containerName, envName string, ref *KeyRefCreate) error {
+	if errs := validation.IsDNS1123Subdomain(ref.Name); len(errs) > 0 {
+		return errors.New(fmt.Sprintf("容器:%s的环境变量:%s引用的名称:%q不合法", containerName, envName, ref.Name))
+	}
+	if errs := validation.IsConfigMapKey(ref.Key); len(errs) > 0 {
+		return errors.New(fmt.Sprintf("容器:%s的环境变量:%s引用的key:%q不合法", containerName, envName, ref.Key))
+	}
+	return nil
+}
+
+func buildEnvFrom(containerName string, e EnvFromCreate) (corev1.EnvFromSource, error) {
+	if (e.ConfigMap == "") == (e.Secret == "") {
+		return corev1.EnvFromSource{}, errors.New(fmt.Sprintf("容器:%s的env_from需设置config_map、secret中的一个", containerName))
+	}
+	if e.Prefix != "" {
+		if errs := validation.IsEnvVarName(e.Prefix); len(errs) > 0 {
+			return corev1.EnvFromSource{}, errors.New(fmt.Sprintf("容器:%s的env_from前缀:%q不合法", containerName, e.Prefix))
+		}
+	}
+	name := e.ConfigMap + e.Secret
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return corev1.EnvFromSource{}, errors.New(fmt.Sprintf("容器:%s的env_from引用的名称:%q不合法", containerName, name))
+	}
+	source := corev1.EnvFromSource{Prefix: e.Prefix}
+	if e.ConfigMap != "" {
+		source.ConfigMapRef = &corev1.ConfigMapEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: e.ConfigMap},
+			Optional:             &e.Optional,
+		}
+	} else {
+		source.SecretRef = &corev1.SecretEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: e.Secret},
+			Optional:             &e.Optional,
+		}
+	}
+	return source, nil
+}
+
+// buildVolume 校验并组装卷，ConfigMap、Secret、PVC 需指定名称
+func buildVolume(v VolumeCreate) (*corev1.Volume, error) {
+	if errs := validation.IsDNS1123Label(v.Name); len(errs) > 0 {
+		return nil, errors.New(fmt.Sprintf("卷名:%q不合法, %s", v.Name, strings.Join(errs, "; ")))
+	}
+	if v.Type == VolumeConfigMap || v.Type == VolumeSecret || v.Type == VolumePVC {
+		if errs := validation.IsDNS1123Subdomain(v.Source); len(errs) > 0 {
+			return nil, errors.New(fmt.Sprintf("卷:%s引用的名称:%q不合法", v.Name, v.Source))
+		}
+	}
+	volume := &corev1.Volume{Name: v.Name}
+	switch v.Type {
+	case VolumeConfigMap:
+		volume.ConfigMap = &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: v.Source}}
+	case VolumeSecret:
+		volume.Secret = &corev1.SecretVolumeSource{SecretName: v.Source}
+	case VolumePVC:
+		volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: v.Source, ReadOnly: v.ReadOnly}
+	case VolumeEmptyDir:
+		emptyDir := &corev1.EmptyDirVolumeSource{}
+		switch corev1.StorageMedium(v.Medium) {
+		case corev1.StorageMediumDefault, corev1.StorageMediumMemory:
+			emptyDir.Medium = corev1.StorageMedium(v.Medium)
+		default:
+			return nil, errors.New(fmt.Sprintf("卷:%s的存储介质:%s不合法，可选 Memory 或不设置", v.Name, v.Medium))
+		}
+		if v.SizeLimit != "" {
+			sizeLimit, err := resource.ParseQuantity(v.SizeLimit)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("卷:%s的容量上限:%s不合法, %v", v.Name, v.SizeLimit, err))
+			}
+			emptyDir.SizeLimit = &sizeLimit
+		}
+		volume.EmptyDir = emptyDir
+	default:
+		return nil, errors.New(fmt.Sprintf("卷:%s的类型:%s不合法，可选 configMap、secret、emptyDir、pvc", v.Name, v.Type))
+	}
+	return volume, nil
+}
+
+// buildVolumeMounts 校验并组装挂载点，卷必须已定义，同一容器中挂载路径不能重复
+func buildVolumeMounts(containerName string, mounts []VolumeMountCreate, volumes map[string]bool) ([]corev1.VolumeMount, error) {
+	var result []corev1.VolumeMount
+	paths := make(map[string]bool)
+	for _, m := range mounts {
+		if !volumes[m.Name] {
+			return nil, errors.New(fmt.Sprintf("容器:%s挂载的卷:%s未定义", containerName, m.Name))
+		}
+		if !path.IsAbs(m.MountPath) {
+			return nil, errors.New(fmt.Sprintf("容器:%s的挂载路径:%s必须为绝对路径", containerName, m.MountPath))
+		}
+		mountPath := path.Clean(m.MountPath)
+		if paths[mountPath] {
+			return nil, errors.New(fmt.Sprintf("容器:%s的挂载路径:%s重复", containerName, mountPath))
+		}
+		paths[mountPath] = true
+		if m.SubPath != "" && (path.IsAbs(m.SubPath) || strings.Contains("/"+m.SubPath+"/", "/../")) {
+			return nil, errors.New(fmt.Sprintf("容器:%s的子路径:%s必须为相对路径且不能包含..", containerName, m.SubPath))
+		}
+		result = append(result, corev1.VolumeMount{
+			Name:      m.Name,
+			MountPath: mountPath,
+			SubPath:   m.SubPath,
+			ReadOnly:  m.ReadOnly,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildPodSpec(t *testing.T) {
+	app := func(mutate func(c *ContainerCreate)) ContainerCreate {
+		c := ContainerCreate{Name: "app", Image: "api:1.0", Ports: []ContainerPortCreate{{Name: "http", ContainerPort: 8080}}}
+		if mutate != nil {
+			mutate(&c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		data    *DeployCreate
+		wantErr string
+		// wantName 不为空时校验第一个容器的名称
+		wantName string
+	}{
+		{name: "单容器字段", data: &DeployCreate{Name: "web", Image: "nginx:1.25", ContainerPort: 8080}, wantName: "web"},
+		{name: "单容器字段，Deployment 名包含.", data: &DeployCreate{Name: "api.v2", Image: "api:2.0", ContainerPort: 8080}, wantName: "api-v2"},
+		{name: "多容器和 init 容器", data: &DeployCreate{
+			Name:           "api",
+			Containers:     []ContainerCreate{app(nil), {Name: "envoy", Image: "envoy:1.26"}},
+			InitContainers: []ContainerCreate{{Name: "migrate", Image: "api:1.0", Command: []string{"/migrate"}}},
+		}},
+		{name: "容器名重复", data: &DeployCreate{
+			Containers:     []ContainerCreate{app(nil)},
+			InitContainers: []ContainerCreate{{Name: "app", Image: "api:1.0"}},
+		}, wantErr: "重复"},
+		{name: "容器名不合法", data: &DeployCreate{Containers: []ContainerCreate{app(func(c *ContainerCreate) { c.Name = "App_1" })}}, wantErr: "不合法"},
+		{name: "镜像为空", data: &DeployCreate{Containers: []ContainerCreate{app(func(c *ContainerCreate) { c.Image = "" })}}, wantErr: "镜像不能为空"},
+		{name: "端口不合法", data: &DeployCreate{Containers: []ContainerCreate{app(func(c *ContainerCreate) { c.Ports[0].ContainerPort = 0 })}}, wantErr: "端口"},
+		{name: "端口协议不合法", data: &DeployCreate{Containers: []ContainerCreate{app(func(c *ContainerCreate) { c.Ports[0].Protocol = "HTTP" })}}, wantErr: "协议"},
+		{name: "资源不合法", data: &DeployCreate{Containers: []ContainerCreate{app(func(c *ContainerCreate) { c.Cpu = "1core" })}}, wantErr: "cpu"},
+		{name: "探针类型不合法", data: &DeployCreate{Containers: []ContainerCreate{app(func(c *ContainerCreate) {
+			c.LivenessProbe = &ProbeCreate{Type: "grpc"}
+		})}}, wantErr: "探针类型"},
+		{name: "exec 探针没有命令", data: &DeployCreate{Containers: []ContainerCreate{app(func(c *ContainerCreate) {
+			c.ReadinessProbe = &ProbeCreate{Type: ProbeExec}
+		})}}, wantErr: "命令不能为空"},
+		{name: "init 容器设置探针", data: &DeployCreate{
+			Containers:     []ContainerCreate{app(nil)},
+			InitContainers: []ContainerCreate{{Name: "init", Image: "busybox", LivenessProbe: &ProbeCreate{Type: ProbeTCP, Port: 80}}},
+		}, wantErr: "不能设置探针"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := buildPodSpec(tt.data)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("buildPodSpec() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("buildPodSpec() error = %v, want %s", err, tt.wantErr)
+			}
+			if tt.wantName != "" && spec.Containers[0].Name != tt.wantName {
+				t.Errorf("buildPodSpec() container name = %s, want %s", spec.Containers[0].Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestCreateDeploymentContainers(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	data := &DeployCreate{
+		Name: "api", Namespace: "default", Replicas: 2, Label: map[string]string{"app": "api"},
+		InitContainers: []ContainerCreate{{Name: "migrate", Image: "api:1.0", Command: []string{"/migrate"}, Args: []string{"--up"}}},
+		Containers: []ContainerCreate{
+			{
+				Name: "app", Image: "api:1.0",
+				Ports: []ContainerPortCreate{{Name: "http", ContainerPort: 8080}, {Name: "metrics", ContainerPort: 9090}},
+				Cpu:   "250m", Memory: "128Mi", MemoryLimit: "256Mi",
+				ReadinessProbe: &ProbeCreate{Type: ProbeHTTP, Path: "/ready"},
+				LivenessProbe:  &ProbeCreate{Type: ProbeTCP, Port: 9090, PeriodSeconds: 20},
+				StartupProbe:   &ProbeCreate{Type: ProbeExec, Command: []string{"cat", "/tmp/started"}},
+			},
+			{Name: "envoy", Image: "envoy:1.26", Ports: []ContainerPortCreate{{ContainerPort: 15001, Protocol: "udp"}}},
+		},
+	}
+	if err := Deployment.CreateDeployment(client, data); err != nil {
+		t.Fatalf("CreateDeployment() error = %v", err)
+	}
+	deploy, err := client.AppsV1().Deployments("default").Get(context.TODO(), "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("获取Deployment失败, %v", err)
+	}
+	spec := deploy.Spec.Template.Spec
+	if len(spec.InitContainers) != 1 || len(spec.Containers) != 2 {
+		t.Fatalf("init containers = %d, containers = %d", len(spec.InitContainers), len(spec.Containers))
+	}
+	if init := spec.InitContainers[0]; init.Command[0] != "/migrate" || init.Args[0] != "--up" {
+		t.Errorf("init container = %+v", init)
+	}
+
+	app := spec.Containers[0]
+	if len(app.Ports) != 2 || app.Ports[0].ContainerPort != 8080 || app.Ports[1].Protocol != corev1.ProtocolTCP {
+		t.Errorf("app ports = %v", app.Ports)
+	}
+	if app.Resources.Requests.Cpu().String() != "250m" || app.Resources.Limits.Memory().String() != "256Mi" {
+		t.Errorf("app resources = %+v", app.Resources)
+	}
+	// 未设置的 limit 不生效
+	if _, ok := app.Resources.Limits[corev1.ResourceCPU]; ok {
+		t.Errorf("未设置 cpu limit, got %v", app.Resources.Limits)
+	}
+	// http 探针未指定端口时使用第一个端口
+	if app.ReadinessProbe.HTTPGet.Path != "/ready" || app.ReadinessProbe.HTTPGet.Port.IntVal != 8080 {
+		t.Errorf("readiness probe = %+v", app.ReadinessProbe.HTTPGet)
+	}
+	if app.LivenessProbe.TCPSocket.Port.IntVal != 9090 || app.LivenessProbe.PeriodSeconds != 20 {
+		t.Errorf("liveness probe = %+v", app.LivenessProbe)
+	}
+	if app.StartupProbe.Exec == nil || app.StartupProbe.Exec.Command[1] != "/tmp/started" {
+		t.Errorf("startup probe = %+v", app.StartupProbe)
+	}
+	if envoy := spec.Containers[1]; envoy.Ports[0].Protocol != corev1.ProtocolUDP {
+		t.Errorf("envoy ports = %v", envoy.Ports)
+	}
+}
+
+func TestBuildPodSpecEnvAndVolumes(t *testing.T) {
+	volumes := []VolumeCreate{
+		{Name: "config", Type: VolumeConfigMap, Source: "api-config"},
+		{Name: "certs", Type: VolumeSecret, Source: "api-tls"},
+		{Name: "cache", Type: VolumeEmptyDir, Medium: "Memory", SizeLimit: "64Mi"},
+		{Name: "data", Type: VolumePVC, Source: "api-data"},
+	}
+	deploy := func(mutate func(c *ContainerCreate), vs ...VolumeCreate) *DeployCreate {
+		c := ContainerCreate{
+			Name: "app", Image: "api:1.0",
+			Env: []EnvCreate{
+				{Name: "MODE", Value: "prod"},
+				{Name: "LOG_LEVEL", ConfigMapKeyRef: &KeyRefCreate{Name: "api-config", Key: "log.level"}},
+				{Name: "DB_PASSWORD", SecretKeyRef: &KeyRefCreate{Name: "api-db", Key: "password"}},
+				{Name: "POD_NAME", FieldRef: "metadata.name"},
+				{Name: "APP", FieldRef: "metadata.labels['app']"},
+			},
+			EnvFrom: []EnvFromCreate{{ConfigMap: "api-env"}, {Secret: "api-secret-env", Prefix: "SECRET_"}},
+			VolumeMounts: []VolumeMountCreate{
+				{Name: "config", MountPath: "/etc/api", ReadOnly: true},
+				{Name: "certs", MountPath: "/etc/tls/tls.crt", SubPath: "tls.crt"},
+				{Name: "cache", MountPath: "/cache"},
+				{Name: "data", MountPath: "/data/"},
+			},
+		}
+		if mutate != nil {
+			mutate(&c)
+		}
+		if len(vs) == 0 {
+			vs = volumes
+		}
+		return &DeployCreate{Containers: []ContainerCreate{c}, Volumes: vs}
+	}
+
+	tests := []struct {
+		name    string
+		data    *DeployCreate
+		wantErr string
+	}{
+		{name: "合法的环境变量和卷", data: deploy(nil)},
+		{name: "环境变量名不合法", data: deploy(func(c *ContainerCreate) { c.Env[0].Name = "1MODE" }), wantErr: "环境变量名"},
+		{name: "环境变量重复", data: deploy(func(c *ContainerCreate) { c.Env[1].Name = "MODE" }), wantErr: "重复"},
+		{name: "环境变量设置多个来源", data: deploy(func(c *ContainerCreate) { c.Env[1].Value = "debug" }), wantErr: "只能设置"},
+		{name: "引用的 key 为空", data: deploy(func(c *ContainerCreate) { c.Env[2].SecretKeyRef.Key = "" }), wantErr: "key"},
+		{name: "引用的字段不支持", data: deploy(func(c *ContainerCreate) { c.Env[3].FieldRef = "spec.containers" }), wantErr: "字段"},
+		{name: "env_from 未设置来源", data: deploy(func(c *ContainerCreate) { c.EnvFrom[0].ConfigMap = "" }), wantErr: "env_from"},
+		{name: "env_from 设置两个来源", data: deploy(func(c *ContainerCreate) { c.EnvFrom[0].Secret = "api-secret" }), wantErr: "env_from"},
+		{name: "env_from 前缀不合法", data: deploy(func(c *ContainerCreate) { c.EnvFrom[1].Prefix = "1_" }), wantErr: "前缀"},
+		{name: "挂载未定义的卷", data: deploy(func(c *ContainerCreate) { c.VolumeMounts[0].Name = "logs" }), wantErr: "未定义"},
+		{name: "挂载路径不是绝对路径", data: deploy(func(c *ContainerCreate) { c.VolumeMounts[0].MountPath = "etc/api" }), wantErr: "绝对路径"},
+		{name: "挂载路径重复", data: deploy(func(c *ContainerCreate) { c.VolumeMounts[3].MountPath = "/cache/" }), wantErr: "重复"},
+		{name: "子路径包含..", data: deploy(func(c *ContainerCreate) { c.VolumeMounts[1].SubPath = "../tls.crt" }), wantErr: "子路径"},
+		{name: "卷名重复", data: deploy(nil, append(volumes, VolumeCreate{Name: "data", Type: VolumeEmptyDir})...), wantErr: "卷名:data重复"},
+		{name: "卷类型不合法", data: deploy(nil, append(volumes, VolumeCreate{Name: "host", Type: "hostPath", Source: "/var"})...), wantErr: "类型"},
+		{name: "卷未指定名称", data: deploy(nil, append(volumes, VolumeCreate{Name: "claim", Type: VolumePVC})...), wantErr: "引用的名称"},
+		{name: "emptyDir 介质不合法", data: deploy(nil, append(volumes, VolumeCreate{Name: "tmp", Type: VolumeEmptyDir, Medium: "Disk"})...), wantErr: "存储介质"},
+		{name: "emptyDir 容量不合法", data: deploy(nil, append(volumes, VolumeCreate{Name: "tmp", Type: VolumeEmptyDir, SizeLimit: "1GB"})...), wantErr: "容量上限"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildPodSpec(tt.data)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("buildPodSpec() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("buildPodSpec() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	spec, err := buildPodSpec(deploy(nil))
+	if err != nil {
+		t.Fatalf("buildPodSpec() error = %v", err)
+	}
+	if len(spec.Volumes) != 4 || spec.Volumes[2].EmptyDir.Medium != corev1.StorageMediumMemory || spec.Volumes[2].EmptyDir.SizeLimit.String() != "64Mi" || spec.Volumes[3].PersistentVolumeClaim.ClaimName != "api-data" {
+		t.Errorf("volumes = %+v", spec.Volumes)
+	}
+	container := spec.Containers[0]
+	if container.Env[1].ValueFrom.ConfigMapKeyRef.Key != "log.level" || container.Env[2].ValueFrom.SecretKeyRef.Name != "api-db" || container.Env[3].ValueFrom.FieldRef.FieldPath != "metadata.name" {
+		t.Errorf("env = %+v", container.Env)
+	}
+	if container.EnvFrom[0].ConfigMapRef.Name != "api-env" || container.EnvFrom[1].SecretRef.Name != "api-secret-env" || container.EnvFrom[1].Prefix != "SECRET_" {
+		t.Errorf("envFrom = %+v", container.EnvFrom)
+	}
+	if container.VolumeMounts[3].MountPath != "/data" || container.VolumeMounts[1].SubPath != "tls.crt" || !container.VolumeMounts[0].ReadOnly {
+		t.Errorf("volumeMounts = %+v", container.VolumeMounts)
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wonderivan/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"kubeadm-platform/config"
+)
+
+// DeploymentLogSource 聚合日志的一个来源容器
+type DeploymentLogSource struct {
+	PodName       string `json:"pod_name"`
+	ContainerName string `json:"container_name"`
+}
+
+func (s DeploymentLogSource) String() string {
+	return s.PodName + "/" + s.ContainerName
+}
+
+// DeploymentLogResp 定义聚合日志的返回类型
+type DeploymentLogResp struct {
+	// Log 按时间戳合并后的日志，每行以 [pod/container] 开头
+	Log string `json:"log"`
+	// Truncated 存在容器的日志在字节上限处被截断
+	Truncated bool `json:"truncated"`
+	// Errors 获取日志失败的容器，key 为 pod/container
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// logLine 带来源和时间戳的一行日志
+type logLine struct {
+	source DeploymentLogSource
+	time   time.Time
+	// timestamp 为 kubelet 添加的时间戳原文，text 为去掉时间戳后的内容
+	timestamp string
+	text      string
+}
+
+// parseLogLine 解析开启 timestamps 后的一行日志，时间戳解析失败时沿用上一行的时间
+func parseLogLine(source DeploymentLogSource, raw string, last time.Time) logLine {
+	line := logLine{source: source, time: last, text: raw}
+	if idx := strings.IndexByte(raw, ' '); idx > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, raw[:idx]); err == nil {
+			line.time, line.timestamp, line.text = t, raw[:idx], raw[idx+1:]
+		}
+	}
+	return line
+}
+
+// format 格式化为 [pod/container] 前缀的日志，withTimestamp 为 true 时保留时间戳
+func (l logLine) format(withTimestamp bool) string {
+	if withTimestamp && l.timestamp != "" {
+		return fmt.Sprintf("[%s] %s %s", l.source, l.timestamp, l.text)
+	}
+	return fmt.Sprintf("[%s] %s", l.source, l.text)
+}
+
+// sortLogLines 按时间戳排序，时间相同时保持原有顺序
+func sortLogLines(lines []logLine) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].time.Before(lines[j].time)
+	})
+}
+
+// GetLogSources 根据 deployment 的 selector 找到所有 pod 的容器
+// containerName 不为空时只返回包含该容器的 pod
+func (d *deployment) GetLogSources(client kubernetes.Interface, deploymentName, namespace, containerName string) ([]DeploymentLogSource, error) {
+	deploy, _, err := d.GetDeploymentDetail(client, deploymentName, namespace, true)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deploy.Spec.Selector)
+	if err != nil {
+		logger.Error(fmt.Sprintf("解析Deployment selector失败, %v", err))
+		return nil, errors.New(fmt.Sprintf("解析Deployment selector失败, %v", err))
+	}
+	pods, _, _, err := Pod.selectPods(client, namespace, &DataSelectorQuery{
+		FilterQuery: &FilterQuery{LabelSelector: selector.String()},
+		SortQuery:   &SortQuery{SortBy: SortByName},
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	var sources []DeploymentLogSource
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			if containerName == "" || container.Name == containerName {
+				sources = append(sources, DeploymentLogSource{PodName: pod.Name, ContainerName: container.Name})
+			}
+		}
+	}
+	if len(sources) == 0 {
+		return nil, errors.New(fmt.Sprintf("Deployment:%s下没有可查看日志的容器", deploymentName))
+	}
+	return sources, nil
+}
+
+// sourceQuery 生成单个来源容器的日志查询条件，强制开启 timestamps 用于合并排序
+func sourceQuery(query *PodLogQuery, source DeploymentLogSource) *PodLogQuery {
+	q := PodLogQuery{}
+	if query != nil {
+		q = *query
+	}
+	q.ContainerName = source.ContainerName
+	q.Timestamps = true
+	return &q
+}
+
+// GetDeploymentLog 并发获取 deployment 下所有容器的日志，按时间戳合并
+// 每个容器分到 config.PodLogMaxBytes 的一份，合并后的日志总量不超过该上限
+func (d *deployment) GetDeploymentLog(client kubernetes.Interface, deploymentName, namespace string, query *PodLogQuery) (*DeploymentLogResp, error) {
+	containerName := ""
+	if query != nil {
+		containerName = query.ContainerName
+	}
+	sources, err := d.GetLogSources(client, deploymentName, namespace, containerName)
+	if err != nil {
+		return nil, err
+	}
+	limit := config.PodLogMaxBytes / len(sources)
+	if limit == 0 {
+		limit = 1
+	}
+
+	type result struct {
+		lines     []logLine
+		truncated bool
+		err       error
+	}
+	results := make([]result, len(sources))
+	sem := make(chan struct{}, config.DeploymentLogConcurrency)
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source DeploymentLogSource) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			// 每个容器保留最新的 limit 字节
+			log, truncated, err := Pod.getPodLogTail(client, source.PodName, namespace, sourceQuery(query, source), limit)
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			var last time.Time
+			for _, raw := range strings.Split(strings.TrimRight(log, "\n"), "\n") {
+				if raw == "" {
+					continue
+				}
+				line := parseLogLine(source, strings.TrimRight(raw, "\r"), last)
+				last = line.time
+				results[i].lines = append(results[i].lines, line)
+			}
+			results[i].truncated = truncated
+		}(i, source)
+	}
+	wg.Wait()
+
+	resp := &DeploymentLogResp{}
+	var lines []logLine
+	for i, r := range results {
+		if r.err != nil {
+			if resp.Errors == nil {
+				resp.Errors = make(map[string]string)
+			}
+			resp.Errors[sources[i].String()] = strings.TrimSpace(r.err.Error())
+			continue
+		}
+		lines = append(lines, r.lines...)
+		resp.Truncated = resp.Truncated || r.truncated
+	}
+	if len(resp.Errors) == len(sources) {
+		return nil, errors.New(fmt.Sprintf("获取Deployment:%s的日志失败, 所有容器均获取失败", deploymentName))
+	}
+	sortLogLines(lines)
+	withTimestamp := query != nil && query.Timestamps
+	var builder strings.Builder
+	for _, line := range lines {
+		builder.WriteString(line.format(withTimestamp))
+		builder.WriteByte('\n')
+	}
+	resp.Log = builder.String()
+	return resp, nil
+}
+
+// FollowDeploymentLog 同时 follow 所有来源容器的日志，每隔 config.DeploymentLogFlushInterval
+// 将收到的日志按时间戳排序后逐行调用 send
+// 只跟踪 sources 中的容器，ctx 取消、send 返回错误或所有日志流结束时返回
+func (d *deployment) FollowDeploymentLog(ctx context.Context, client kubernetes.Interface, namespace string, sources []DeploymentLogSource, query *PodLogQuery, send func(line string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lines := make(chan logLine, 256)
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source DeploymentLogSource) {
+			defer wg.Done()
+			push := func(line logLine) error {
+				select {
+				case lines <- line:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			stream, err := Pod.FollowPodLog(ctx, client, source.PodName, namespace, sourceQuery(query, source))
+			if err != nil {
+				// 单个容器失败不影响其他容器，以日志行的形式通知客户端
+				_ = push(logLine{source: source, time: time.Now(), text: strings.TrimSpace(err.Error())})
+				return
+			}
+			defer stream.Close()
+			var last time.Time
+			_ = Pod.StreamLogLines(ctx, stream, func(raw string) error {
+				line := parseLogLine(source, raw, last)
+				last = line.time
+				return push(line)
+			})
+		}(source)
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	withTimestamp := query != nil && query.Timestamps
+	var batch []logLine
+	flush := func() error {
+		sortLogLines(batch)
+		for _, line := range batch {
+			if err := send(line.format(withTimestamp)); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	ticker := time.NewTicker(config.DeploymentLogFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return flush()
+			}
+			batch = append(batch, line)
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
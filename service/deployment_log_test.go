@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMergeLogLines(t *testing.T) {
+	web1 := DeploymentLogSource{PodName: "web-1", ContainerName: "nginx"}
+	web2 := DeploymentLogSource{PodName: "web-2", ContainerName: "nginx"}
+	var lines []logLine
+	var last time.Time
+	for _, raw := range []string{
+		"2023-05-01T08:00:01.000000000Z GET /a",
+		"2023-05-01T08:00:03.000000000Z GET /c",
+		"stack trace without timestamp",
+	} {
+		line := parseLogLine(web1, raw, last)
+		last = line.time
+		lines = append(lines, line)
+	}
+	lines = append(lines,
+		parseLogLine(web2, "2023-05-01T08:00:02.500000000Z GET /b", time.Time{}),
+		parseLogLine(web2, "2023-05-01T08:00:04Z GET /d", time.Time{}),
+	)
+	sortLogLines(lines)
+
+	var got []string
+	for _, line := range lines {
+		got = append(got, line.format(false))
+	}
+	// 没有时间戳的行沿用上一行的时间，跟随在原来的位置
+	want := []string{
+		"[web-1/nginx] GET /a",
+		"[web-2/nginx] GET /b",
+		"[web-1/nginx] GET /c",
+		"[web-1/nginx] stack trace without timestamp",
+		"[web-2/nginx] GET /d",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("合并后的日志 = %v, want %v", got, want)
+	}
+	if got := lines[0].format(true); got != "[web-1/nginx] 2023-05-01T08:00:01.000000000Z GET /a" {
+		t.Errorf("format(true) = %s", got)
+	}
+}
+
+func TestGetDeploymentLog(t *testing.T) {
+	newPod := func(name string, labels map[string]string, containers ...string) *corev1.Pod {
+		pod := newTestPod(name, "default", time.Hour)
+		pod.Labels = labels
+		for _, container := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+		}
+		return pod
+	}
+	client := fake.NewSimpleClientset(
+		newTestDeployment("web", "default", 2),
+		newPod("web-1", map[string]string{"app": "web"}, "web", "sidecar"),
+		newPod("web-2", map[string]string{"app": "web"}, "web"),
+		newPod("other-1", map[string]string{"app": "other"}, "other"),
+	)
+	defer Cache.Evict(client)
+
+	sources, err := Deployment.GetLogSources(client, "web", "default", "")
+	if err != nil {
+		t.Fatalf("GetLogSources() error = %v", err)
+	}
+	if len(sources) != 3 {
+		t.Errorf("GetLogSources() = %v, want 3 个容器", sources)
+	}
+	sources, err = Deployment.GetLogSources(client, "web", "default", "sidecar")
+	if err != nil || len(sources) != 1 || sources[0].String() != "web-1/sidecar" {
+		t.Errorf("GetLogSources(sidecar) = %v, %v", sources, err)
+	}
+	if _, err := Deployment.GetLogSources(client, "web", "default", "missing"); err == nil {
+		t.Errorf("GetLogSources() 容器不存在时应返回错误")
+	}
+
+	// fake clientset 固定返回 fake logs
+	resp, err := Deployment.GetDeploymentLog(client, "web", "default", &PodLogQuery{ContainerName: "web"})
+	if err != nil {
+		t.Fatalf("GetDeploymentLog() error = %v", err)
+	}
+	if resp.Log != "[web-1/web] fake logs\n[web-2/web] fake logs\n" || resp.Truncated || len(resp.Errors) != 0 {
+		t.Errorf("GetDeploymentLog() = %+v", resp)
+	}
+
+	// follow 模式下所有日志流结束后返回
+	var lines []string
+	err = Deployment.FollowDeploymentLog(context.Background(), client, "default", sources[:1], nil, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil || len(lines) != 1 || lines[0] != "[web-1/sidecar] fake logs" {
+		t.Errorf("FollowDeploymentLog() lines = %v, error = %v", lines, err)
+	}
+}
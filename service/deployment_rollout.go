@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/wonderivan/logger"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+	"sigs.k8s.io/yaml"
+
+	"kubeadm-platform/config"
+)
+
+// changeCauseAnnotation 记录变更原因的注解，与 kubectl rollout history 的 CHANGE-CAUSE 一致
+const changeCauseAnnotation = "kubernetes.io/change-cause"
+
+// DeploymentRevision deployment 的一个历史版本，对应一个 ReplicaSet
+type DeploymentRevision struct {
+	Revision       int64    `json:"revision"`
+	ReplicaSetName string   `json:"replicaset_name"`
+	Images         []string `json:"images"`
+	ChangeCause    string   `json:"change_cause,omitempty"`
+	// Replicas 该版本当前的副本数，旧版本通常为 0
+	Replicas          int32       `json:"replicas"`
+	Current           bool        `json:"current"`
+	CreationTimestamp metav1.Time `json:"creation_timestamp"`
+}
+
+// revisionReplicaSet 带版本号的 ReplicaSet
+type revisionReplicaSet struct {
+	revision int64
+	rs       *appsv1.ReplicaSet
+}
+
+// listRevisions 获取 deployment 管理的所有 ReplicaSet，按版本号从小到大排序
+func (d *deployment) listRevisions(client kubernetes.Interface, deploy *appsv1.Deployment) ([]revisionReplicaSet, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deploy.Spec.Selector)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("解析Deployment selector失败, %v", err))
+	}
+	rsList, err := client.AppsV1().ReplicaSets(deploy.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("获取ReplicaSet列表失败, %v", err))
+	}
+	var revisions []revisionReplicaSet
+	for i := range rsList.Items {
+		rs := &rsList.Items[i]
+		// 只保留由该 deployment 控制的 ReplicaSet
+		if owner := metav1.GetControllerOf(rs); owner == nil || owner.UID != deploy.UID {
+			continue
+		}
+		revision, err := replicaSetRevision(rs)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, revisionReplicaSet{revision: revision, rs: rs})
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].revision < revisions[j].revision })
+	return revisions, nil
+}
+
+// replicaSetRevision 返回 ReplicaSet 对应的版本号，没有版本号注解时返回错误
+func replicaSetRevision(rs *appsv1.ReplicaSet) (int64, error) {
+	return strconv.ParseInt(rs.Annotations[deploymentRevisionAnnotation], 10, 64)
+}
+
+// GetRevisions 获取 deployment 的历史版本，按版本号从新到旧排序
+func (d *deployment) GetRevisions(client kubernetes.Interface, deploymentName, namespace string) ([]DeploymentRevision, error) {
+	deploy, _, err := d.GetDeploymentDetail(client, deploymentName, namespace, false)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := d.listRevisions(client, deploy)
+	if err != nil {
+		logger.Error(fmt.Sprintf("获取Deployment历史版本失败, %v", err))
+		return nil, errors.New(fmt.Sprintf("获取Deployment历史版本失败, %v", err))
+	}
+	current := deploymentRevision(deploy)
+	resp := make([]DeploymentRevision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		rs := revisions[i].rs
+		resp = append(resp, DeploymentRevision{
+			Revision:          revisions[i].revision,
+			ReplicaSetName:    rs.Name,
+			Images:            containerImages(&rs.Spec.Template.Spec),
+			ChangeCause:       rs.Annotations[changeCauseAnnotation],
+			Replicas:          rs.Status.Replicas,
+			Current:           revisions[i].revision == current,
+			CreationTimestamp: rs.CreationTimestamp,
+		})
+	}
+	return resp, nil
+}
+
+// findRevision 查找指定版本，revision 为 0 时返回当前版本的上一个版本
+func findRevision(revisions []revisionReplicaSet, revision, current int64) (*appsv1.ReplicaSet, error) {
+	if revision == 0 {
+		for i := len(revisions) - 1; i >= 0; i-- {
+			if revisions[i].revision < current {
+				return revisions[i].rs, nil
+			}
+		}
+		return nil, errors.New("没有可回滚的上一个版本")
+	}
+	for _, r := range revisions {
+		if r.revision == revision {
+			return r.rs, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("版本:%d不存在", revision))
+}
+
+// revisionTemplate 返回 ReplicaSet 的 pod 模板，去掉 controller 添加的 pod-template-hash 标签
+func revisionTemplate(rs *appsv1.ReplicaSet) *corev1.PodTemplateSpec {
+	template := rs.Spec.Template.DeepCopy()
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	return template
+}
+
+// DiffRevisions 对比两个版本的 pod 模板，返回 unified diff 格式的差异
+// to 为 0 时与 deployment 当前的模板对比
+func (d *deployment) DiffRevisions(client kubernetes.Interface, deploymentName, namespace string, from, to int64) (string, error) {
+	if from == 0 {
+		return "", errors.New("请指定对比的版本")
+	}
+	deploy, _, err := d.GetDeploymentDetail(client, deploymentName, namespace, false)
+	if err != nil {
+		return "", err
+	}
+	diff, err := d.diffRevisions(client, deploy, from, to)
+	if err != nil {
+		logger.Error(fmt.Sprintf("对比Deployment版本失败, %v", err))
+		return "", errors.New(fmt.Sprintf("对比Deployment版本失败, %v", err))
+	}
+	return diff, nil
+}
+
+func (d *deployment) diffRevisions(client kubernetes.Interface, deploy *appsv1.Deployment, from, to int64) (string, error) {
+	revisions, err := d.listRevisions(client, deploy)
+	if err != nil {
+		return "", err
+	}
+	fromRS, err := findRevision(revisions, from, 0)
+	if err != nil {
+		return "", err
+	}
+	toTemplate, toName := &deploy.Spec.Template, "current"
+	if to != 0 {
+		toRS, err := findRevision(revisions, to, 0)
+		if err != nil {
+			return "", err
+		}
+		toTemplate, toName = revisionTemplate(toRS), fmt.Sprintf("revision %d", to)
+	}
+	return templateDiff(revisionTemplate(fromRS), toTemplate, fmt.Sprintf("revision %d", from), toName)
+}
+
+// templateDiff 将两个 pod 模板序列化为 yaml 后逐行对比
+func templateDiff(from, to *corev1.PodTemplateSpec, fromName, toName string) (string, error) {
+	fromYAML, err := yaml.Marshal(from)
+	if err != nil {
+		return "", err
+	}
+	toYAML, err := yaml.Marshal(to)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(fromYAML)),
+		B:        difflib.SplitLines(string(toYAML)),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
+
+// RollbackDeployment 将 deployment 的 pod 模板恢复为指定版本，revision 为 0 时回滚到上一个版本
+// 与 kubectl rollout undo 相同，回滚会生成一个新的版本号，暂停状态的 deployment 不能回滚
+func (d *deployment) RollbackDeployment(client kubernetes.Interface, deploymentName, namespace string, revision int64) (rolledBack bool, err error) {
+	deploy, _, err := d.GetDeploymentDetail(client, deploymentName, namespace, false)
+	if err != nil {
+		return false, err
+	}
+	if deploy.Spec.Paused {
+		return false, errors.New(fmt.Sprintf("Deployment:%s已暂停，请先恢复再回滚", deploymentName))
+	}
+	revisions, err := d.listRevisions(client, deploy)
+	if err != nil {
+		logger.Error(fmt.Sprintf("回滚Deployment失败, %v", err))
+		return false, errors.New(fmt.Sprintf("回滚Deployment失败, %v", err))
+	}
+	rs, err := findRevision(revisions, revision, deploymentRevision(deploy))
+	if err != nil {
+		logger.Error(fmt.Sprintf("回滚Deployment失败, %v", err))
+		return false, errors.New(fmt.Sprintf("回滚Deployment失败, %v", err))
+	}
+	template := revisionTemplate(rs)
+	// 模板与当前相同时不需要回滚
+	if apiequality.Semantic.DeepEqual(template, &deploy.Spec.Template) {
+		return false, nil
+	}
+	deploy.Spec.Template = *template
+	if cause, ok := rs.Annotations[changeCauseAnnotation]; ok {
+		if deploy.Annotations == nil {
+			deploy.Annotations = make(map[string]string)
+		}
+		deploy.Annotations[changeCauseAnnotation] = cause
+	}
+	_, err = client.AppsV1().Deployments(namespace).Update(context.TODO(), deploy, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Error(fmt.Sprintf("回滚Deployment失败, %v", err))
+		return false, errors.New(fmt.Sprintf("回滚Deployment失败, %v", err))
+	}
+	return true, nil
+}
+
+// RolloutStatus deployment 的发布进度
+type RolloutStatus struct {
+	// State 发布状态，complete、progressing、stalled、paused
+	State string `json:"state"`
+	// Message 与 kubectl rollout status 输出一致的进度说明
+	Message           string `json:"message"`
+	Revision          int64  `json:"revision"`
+	Replicas          int32  `json:"replicas"`
+	UpdatedReplicas   int32  `json:"updated_replicas"`
+	ReadyReplicas     int32  `json:"ready_replicas"`
+	AvailableReplicas int32  `json:"available_replicas"`
+}
+
+// newRolloutStatus 根据 deployment 的 status 计算发布进度
+func newRolloutStatus(d *appsv1.Deployment) *RolloutStatus {
+	state, message := rolloutState(d)
+	status := &RolloutStatus{
+		State:             state,
+		Revision:          deploymentRevision(d),
+		Replicas:          desiredReplicas(d),
+		UpdatedReplicas:   d.Status.UpdatedReplicas,
+		ReadyReplicas:     d.Status.ReadyReplicas,
+		AvailableReplicas: d.Status.AvailableReplicas,
+	}
+	switch {
+	case state == RolloutComplete:
+		status.Message = fmt.Sprintf("Deployment:%s发布成功", d.Name)
+	case state == RolloutStalled:
+		status.Message = fmt.Sprintf("Deployment:%s发布失败, %s", d.Name, message)
+	case state == RolloutPaused:
+		status.Message = fmt.Sprintf("Deployment:%s已暂停，恢复后继续发布", d.Name)
+	case d.Status.ObservedGeneration < d.Generation:
+		status.Message = "等待最新的配置生效"
+	case message != "":
+		status.Message = fmt.Sprintf("等待发布完成: 创建副本失败, %s", message)
+	case d.Status.UpdatedReplicas < status.Replicas:
+		status.Message = fmt.Sprintf("等待发布完成: 已更新%d/%d个副本", d.Status.UpdatedReplicas, status.Replicas)
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		status.Message = fmt.Sprintf("等待发布完成: %d个旧副本等待终止", d.Status.Replicas-d.Status.UpdatedReplicas)
+	default:
+		status.Message = fmt.Sprintf("等待发布完成: 已更新的副本中%d/%d个可用", d.Status.AvailableReplicas, d.Status.UpdatedReplicas)
+	}
+	return status
+}
+
+// WatchRolloutStatus 监听 deployment 的发布进度，进度变化时调用 send，直到发布完成、失败或超时
+// 发布完成时返回最终进度；超过 progressDeadlineSeconds、deployment 被删除或超时返回错误
+// timeout 为 0 时使用 config.RolloutStatusTimeout，不能超过 config.RolloutStatusMaxTimeout
+func (d *deployment) WatchRolloutStatus(ctx context.Context, client kubernetes.Interface, deploymentName, namespace string, timeout time.Duration, send func(status *RolloutStatus) error) (*RolloutStatus, error) {
+	if timeout <= 0 {
+		timeout = config.RolloutStatusTimeout
+	}
+	if timeout > config.RolloutStatusMaxTimeout {
+		return nil, errors.New(fmt.Sprintf("超时时间不能超过%s", config.RolloutStatusMaxTimeout))
+	}
+	// 先确认 deployment 存在，之后再开始推送
+	if _, _, err := d.GetDeploymentDetail(client, deploymentName, namespace, false); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", deploymentName).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return client.AppsV1().Deployments(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return client.AppsV1().Deployments(namespace).Watch(ctx, options)
+		},
+	}
+	var last *RolloutStatus
+	_, err := watchtools.UntilWithSync(ctx, lw, &appsv1.Deployment{}, nil, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Deleted {
+			return false, errors.New(fmt.Sprintf("Deployment:%s已被删除", deploymentName))
+		}
+		deploy, ok := event.Object.(*appsv1.Deployment)
+		if !ok {
+			return false, nil
+		}
+		status := newRolloutStatus(deploy)
+		// 只推送有变化的进度
+		if last == nil || *last != *status {
+			last = status
+			if err := send(status); err != nil {
+				return false, err
+			}
+		}
+		switch status.State {
+		case RolloutComplete:
+			return true, nil
+		case RolloutStalled:
+			return false, errors.New(status.Message)
+		}
+		return false, nil
+	})
+	if wait.Interrupted(err) {
+		err = errors.New(fmt.Sprintf("等待发布完成超时(%s)", timeout))
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("获取Deployment发布状态失败, %v", err))
+		return last, errors.New(fmt.Sprintf("获取Deployment发布状态失败, %v", err))
+	}
+	return last, nil
+}
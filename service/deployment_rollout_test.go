@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestReplicaSet 构造 deployment 的一个版本，模板中带有 controller 添加的 pod-template-hash 标签
+func newTestReplicaSet(deploy *appsv1.Deployment, revision int64, image, changeCause string) *appsv1.ReplicaSet {
+	isController := true
+	template := deploy.Spec.Template.DeepCopy()
+	template.Spec.Containers[0].Image = image
+	hash := "hash-" + strconv.FormatInt(revision, 10)
+	template.Labels = map[string]string{"app": deploy.Name, appsv1.DefaultDeploymentUniqueLabelKey: hash}
+	annotations := map[string]string{deploymentRevisionAnnotation: strconv.FormatInt(revision, 10)}
+	if changeCause != "" {
+		annotations[changeCauseAnnotation] = changeCause
+	}
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              deploy.Name + "-" + hash,
+			Namespace:         deploy.Namespace,
+			Labels:            template.Labels,
+			Annotations:       annotations,
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Duration(10-revision) * time.Hour)),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       deploy.Name,
+				UID:        deploy.UID,
+				Controller: &isController,
+			}},
+		},
+		Spec: appsv1.ReplicaSetSpec{Template: *template},
+	}
+}
+
+func newRolloutClient() *fake.Clientset {
+	deploy := newTestDeployment("web", "default", 2)
+	deploy.UID = types.UID("web-uid")
+	deploy.Annotations = map[string]string{deploymentRevisionAnnotation: "3"}
+	deploy.Spec.Template.Spec.Containers[0].Image = "nginx:1.25"
+	// 其他 deployment 创建的同标签 ReplicaSet 不属于该 deployment
+	other := newTestReplicaSet(deploy, 9, "nginx:latest", "")
+	other.Name, other.OwnerReferences[0].UID = "web-other", types.UID("other-uid")
+	return fake.NewSimpleClientset(deploy,
+		newTestReplicaSet(deploy, 1, "nginx:1.23", "kubectl create"),
+		newTestReplicaSet(deploy, 2, "nginx:1.24", "升级到1.24"),
+		newTestReplicaSet(deploy, 3, "nginx:1.25", ""),
+		other,
+	)
+}
+
+func TestGetRevisions(t *testing.T) {
+	client := newRolloutClient()
+	revisions, err := Deployment.GetRevisions(client, "web", "default")
+	if err != nil {
+		t.Fatalf("GetRevisions() error = %v", err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("GetRevisions() = %+v, want 3 个版本", revisions)
+	}
+	if revisions[0].Revision != 3 || !revisions[0].Current || revisions[1].Current {
+		t.Errorf("GetRevisions() 应按版本号倒序且标记当前版本, got %+v", revisions)
+	}
+	if revisions[1].ChangeCause != "升级到1.24" || revisions[1].Images[0] != "nginx:1.24" {
+		t.Errorf("GetRevisions()[1] = %+v", revisions[1])
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	client := newRolloutClient()
+	diff, err := Deployment.DiffRevisions(client, "web", "default", 1, 2)
+	if err != nil {
+		t.Fatalf("DiffRevisions() error = %v", err)
+	}
+	if !strings.Contains(diff, "-  - image: nginx:1.23") || !strings.Contains(diff, "+  - image: nginx:1.24") {
+		t.Errorf("DiffRevisions() = %s", diff)
+	}
+	// pod-template-hash 标签不计入差异
+	if strings.Contains(diff, appsv1.DefaultDeploymentUniqueLabelKey) {
+		t.Errorf("DiffRevisions() 不应包含 pod-template-hash, got %s", diff)
+	}
+	// 与当前模板对比没有差异
+	if diff, err := Deployment.DiffRevisions(client, "web", "default", 3, 0); err != nil || diff != "" {
+		t.Errorf("DiffRevisions(3, current) = %q, %v", diff, err)
+	}
+	if _, err := Deployment.DiffRevisions(client, "web", "default", 8, 0); err == nil {
+		t.Errorf("DiffRevisions() 版本不存在时应返回错误")
+	}
+}
+
+func TestRollbackDeployment(t *testing.T) {
+	tests := []struct {
+		name           string
+		revision       int64
+		wantRolledBack bool
+		wantImage      string
+		wantErr        bool
+	}{
+		{name: "回滚到上一个版本", revision: 0, wantRolledBack: true, wantImage: "nginx:1.24"},
+		{name: "回滚到指定版本", revision: 1, wantRolledBack: true, wantImage: "nginx:1.23"},
+		{name: "与当前版本相同", revision: 3, wantImage: "nginx:1.25"},
+		{name: "版本不存在", revision: 5, wantErr: true},
+		{name: "其他 deployment 的版本", revision: 9, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newRolloutClient()
+			rolledBack, err := Deployment.RollbackDeployment(client, "web", "default", tt.revision)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RollbackDeployment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if rolledBack != tt.wantRolledBack {
+				t.Errorf("RollbackDeployment() = %v, want %v", rolledBack, tt.wantRolledBack)
+			}
+			deploy, _ := client.AppsV1().Deployments("default").Get(context.TODO(), "web", metav1.GetOptions{})
+			if got := deploy.Spec.Template.Spec.Containers[0].Image; got != tt.wantImage {
+				t.Errorf("回滚后的镜像 = %s, want %s", got, tt.wantImage)
+			}
+			if _, ok := deploy.Spec.Template.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok {
+				t.Errorf("回滚后的模板不应包含 pod-template-hash")
+			}
+		})
+	}
+
+	// 暂停状态不能回滚
+	client := newRolloutClient()
+	deploy, _ := client.AppsV1().Deployments("default").Get(context.TODO(), "web", metav1.GetOptions{})
+	deploy.Spec.Paused = true
+	_, _ = client.AppsV1().Deployments("default").Update(context.TODO(), deploy, metav1.UpdateOptions{})
+	if _, err := Deployment.RollbackDeployment(client, "web", "default", 0); err == nil {
+		t.Errorf("RollbackDeployment() 暂停状态应返回错误")
+	}
+}
+
+func TestWatchRolloutStatus(t *testing.T) {
+	newProgressing := func() *appsv1.Deployment {
+		deploy := newTestDeployment("web", "default", 2)
+		deploy.Generation, deploy.Status.ObservedGeneration = 1, 1
+		deploy.Status.Replicas, deploy.Status.UpdatedReplicas, deploy.Status.AvailableReplicas = 3, 1, 1
+		return deploy
+	}
+
+	t.Run("发布完成", func(t *testing.T) {
+		client := fake.NewSimpleClientset(newProgressing())
+		done := make(chan struct{})
+		defer close(done)
+		var messages []string
+		status, err := Deployment.WatchRolloutStatus(context.Background(), client, "web", "default", 0, func(status *RolloutStatus) error {
+			messages = append(messages, status.Message)
+			if len(messages) > 1 {
+				return nil
+			}
+			// 收到初始进度后模拟 controller 完成发布，watch 建立前的更新可能丢失，持续更新直到结束
+			go func() {
+				deploy := newProgressing()
+				deploy.Status.Replicas, deploy.Status.UpdatedReplicas, deploy.Status.ReadyReplicas, deploy.Status.AvailableReplicas = 2, 2, 2, 2
+				for {
+					select {
+					case <-done:
+						return
+					case <-time.After(20 * time.Millisecond):
+						_, _ = client.AppsV1().Deployments("default").Update(context.TODO(), deploy, metav1.UpdateOptions{})
+					}
+				}
+			}()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WatchRolloutStatus() error = %v", err)
+		}
+		if status.State != RolloutComplete || len(messages) != 2 || messages[0] != "等待发布完成: 已更新1/2个副本" {
+			t.Errorf("WatchRolloutStatus() = %+v, messages = %v", status, messages)
+		}
+	})
+
+	t.Run("超过发布期限", func(t *testing.T) {
+		deploy := newProgressing()
+		deploy.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentProgressing,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: "timed out",
+		}}
+		client := fake.NewSimpleClientset(deploy)
+		status, err := Deployment.WatchRolloutStatus(context.Background(), client, "web", "default", 0, func(*RolloutStatus) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "timed out") || status.State != RolloutStalled {
+			t.Errorf("WatchRolloutStatus() = %+v, %v", status, err)
+		}
+	})
+
+	t.Run("忽略上一次发布遗留的 condition", func(t *testing.T) {
+		// 修复卡住的发布后，controller 处理新的 spec 之前仍保留 ProgressDeadlineExceeded
+		deploy := newProgressing()
+		deploy.Generation = 3
+		deploy.Status.ObservedGeneration = 2
+		deploy.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentProgressing,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: "old rollout timed out",
+		}}
+		client := fake.NewSimpleClientset(deploy)
+		var messages []string
+		status, err := Deployment.WatchRolloutStatus(context.Background(), client, "web", "default", 100*time.Millisecond, func(status *RolloutStatus) error {
+			messages = append(messages, status.Message)
+			return nil
+		})
+		if err == nil || !strings.Contains(err.Error(), "超时") || status.State != RolloutProgressing || len(messages) != 1 || messages[0] != "等待最新的配置生效" {
+			t.Errorf("WatchRolloutStatus() = %+v, %v, messages = %v", status, err, messages)
+		}
+	})
+
+	t.Run("创建副本失败时继续等待", func(t *testing.T) {
+		deploy := newProgressing()
+		deploy.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentReplicaFailure,
+			Status:  corev1.ConditionTrue,
+			Message: "exceeded quota",
+		}}
+		client := fake.NewSimpleClientset(deploy)
+		status, err := Deployment.WatchRolloutStatus(context.Background(), client, "web", "default", 100*time.Millisecond, func(*RolloutStatus) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "超时") || status.State != RolloutProgressing || status.Message != "等待发布完成: 创建副本失败, exceeded quota" {
+			t.Errorf("WatchRolloutStatus() = %+v, %v", status, err)
+		}
+	})
+
+	t.Run("等待超时", func(t *testing.T) {
+		client := fake.NewSimpleClientset(newProgressing())
+		_, err := Deployment.WatchRolloutStatus(context.Background(), client, "web", "default", 100*time.Millisecond, func(*RolloutStatus) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "超时") {
+			t.Errorf("WatchRolloutStatus() error = %v", err)
+		}
+	})
+
+	t.Run("deployment 不存在", func(t *testing.T) {
+		client := fake.NewSimpleClientset()
+		sent := false
+		_, err := Deployment.WatchRolloutStatus(context.Background(), client, "web", "default", 0, func(*RolloutStatus) error {
+			sent = true
+			return nil
+		})
+		if err == nil || sent {
+			t.Errorf("WatchRolloutStatus() error = %v, sent = %v", err, sent)
+		}
+	})
+}
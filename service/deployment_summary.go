@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// deploymentRevisionAnnotation deployment controller 记录版本号的注解
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// 发布状态
+const (
+	// RolloutComplete 所有副本已更新到最新版本且可用
+	RolloutComplete = "complete"
+	// RolloutProgressing 正在发布
+	RolloutProgressing = "progressing"
+	// RolloutStalled 发布超过 progressDeadlineSeconds 仍未完成
+	RolloutStalled = "stalled"
+	// RolloutPaused 发布已暂停
+	RolloutPaused = "paused"
+)
+
+// DeploymentSummary 列表使用的 deployment 摘要，根据 status 和 conditions 计算，完整对象通过详情接口获取
+type DeploymentSummary struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Replicas 期望副本数，其余为 status 中的副本数
+	Replicas            int32 `json:"replicas"`
+	UpdatedReplicas     int32 `json:"updated_replicas"`
+	ReadyReplicas       int32 `json:"ready_replicas"`
+	AvailableReplicas   int32 `json:"available_replicas"`
+	UnavailableReplicas int32 `json:"unavailable_replicas"`
+	// Ready 就绪副本数/期望副本数，如 2/3
+	Ready string `json:"ready"`
+	// Status 所有期望副本都可用时为 available，否则为 unavailable
+	Status string `json:"status"`
+	// RolloutState 发布状态，complete、progressing、stalled、paused
+	RolloutState string `json:"rollout_state"`
+	// RolloutMessage 发布卡住或创建副本失败时的原因
+	RolloutMessage string   `json:"rollout_message,omitempty"`
+	Images         []string `json:"images"`
+	// Revision 当前版本号，deployment controller 尚未处理时为 0
+	Revision          int64       `json:"revision"`
+	Age               string      `json:"age"`
+	CreationTimestamp metav1.Time `json:"creation_timestamp"`
+}
+
+// toDeploymentSummaries 将 deployment 列表转换为摘要
+func toDeploymentSummaries(deployments []appsv1.Deployment) []DeploymentSummary {
+	summaries := make([]DeploymentSummary, len(deployments))
+	now := time.Now()
+	for i := range deployments {
+		summaries[i] = newDeploymentSummary(&deployments[i], now)
+	}
+	return summaries
+}
+
+func newDeploymentSummary(d *appsv1.Deployment, now time.Time) DeploymentSummary {
+	state, message := rolloutState(d)
+	return DeploymentSummary{
+		Name:                d.Name,
+		Namespace:           d.Namespace,
+		Labels:              d.Labels,
+		Replicas:            desiredReplicas(d),
+		UpdatedReplicas:     d.Status.UpdatedReplicas,
+		ReadyReplicas:       d.Status.ReadyReplicas,
+		AvailableReplicas:   d.Status.AvailableReplicas,
+		UnavailableReplicas: d.Status.UnavailableReplicas,
+		Ready:               fmt.Sprintf("%d/%d", d.Status.ReadyReplicas, desiredReplicas(d)),
+		Status:              deploymentStatus(d),
+		RolloutState:        state,
+		RolloutMessage:      message,
+		Images:              containerImages(&d.Spec.Template.Spec),
+		Revision:            deploymentRevision(d),
+		Age:                 duration.HumanDuration(now.Sub(d.CreationTimestamp.Time)),
+		CreationTimestamp:   d.CreationTimestamp,
+	}
+}
+
+// deploymentRevision 返回 deployment 当前的版本号
+func deploymentRevision(d *appsv1.Deployment) int64 {
+	revision, _ := strconv.ParseInt(d.Annotations[deploymentRevisionAnnotation], 10, 64)
+	return revision
+}
+
+// rolloutState 按 kubectl rollout status 的规则计算发布状态，返回 stalled 的原因或创建副本失败的原因
+// controller 处理最新的 spec 之前，conditions 可能是上一次发布遗留的，不作为判断依据
+// 创建副本失败（如超出配额）可能是暂时的，仍视为正在发布
+func rolloutState(d *appsv1.Deployment) (state, message string) {
+	if d.Spec.Paused {
+		return RolloutPaused, ""
+	}
+	// controller 尚未处理最新的 spec
+	if d.Status.ObservedGeneration < d.Generation {
+		return RolloutProgressing, ""
+	}
+	for _, condition := range d.Status.Conditions {
+		switch {
+		case condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded":
+			return RolloutStalled, condition.Message
+		case condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue:
+			message = condition.Message
+		}
+	}
+	desired := desiredReplicas(d)
+	// 新版本副本未全部创建、旧版本副本未全部删除或新版本副本未全部可用
+	if d.Status.UpdatedReplicas < desired || d.Status.Replicas > d.Status.UpdatedReplicas || d.Status.AvailableReplicas < d.Status.UpdatedReplicas {
+		return RolloutProgressing, message
+	}
+	return RolloutComplete, ""
+}
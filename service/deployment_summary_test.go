@@ -0,0 +1,112 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRolloutState(t *testing.T) {
+	newDeploy := func(mutate func(d *appsv1.Deployment)) *appsv1.Deployment {
+		d := newTestDeployment("web", "default", 3)
+		d.Generation, d.Status.ObservedGeneration = 2, 2
+		d.Status.Replicas, d.Status.UpdatedReplicas, d.Status.ReadyReplicas, d.Status.AvailableReplicas = 3, 3, 3, 3
+		if mutate != nil {
+			mutate(d)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name        string
+		deploy      *appsv1.Deployment
+		wantState   string
+		wantMessage string
+	}{
+		{name: "发布完成", deploy: newDeploy(nil), wantState: RolloutComplete},
+		{name: "已暂停", deploy: newDeploy(func(d *appsv1.Deployment) { d.Spec.Paused = true }), wantState: RolloutPaused},
+		{
+			name:      "controller 未处理最新版本",
+			deploy:    newDeploy(func(d *appsv1.Deployment) { d.Generation = 3 }),
+			wantState: RolloutProgressing,
+		},
+		{
+			name: "旧副本未删除",
+			deploy: newDeploy(func(d *appsv1.Deployment) {
+				d.Status.Replicas, d.Status.UpdatedReplicas = 4, 2
+			}),
+			wantState: RolloutProgressing,
+		},
+		{
+			name:      "新副本未全部可用",
+			deploy:    newDeploy(func(d *appsv1.Deployment) { d.Status.AvailableReplicas = 2 }),
+			wantState: RolloutProgressing,
+		},
+		{
+			name: "超过发布期限",
+			deploy: newDeploy(func(d *appsv1.Deployment) {
+				d.Status.UpdatedReplicas = 1
+				d.Status.Conditions = []appsv1.DeploymentCondition{{
+					Type:    appsv1.DeploymentProgressing,
+					Status:  corev1.ConditionFalse,
+					Reason:  "ProgressDeadlineExceeded",
+					Message: `ReplicaSet "web-5d8f" has timed out progressing.`,
+				}}
+			}),
+			wantState:   RolloutStalled,
+			wantMessage: `ReplicaSet "web-5d8f" has timed out progressing.`,
+		},
+		{
+			name: "创建副本失败",
+			deploy: newDeploy(func(d *appsv1.Deployment) {
+				d.Status.UpdatedReplicas = 2
+				d.Status.Conditions = []appsv1.DeploymentCondition{{
+					Type:    appsv1.DeploymentReplicaFailure,
+					Status:  corev1.ConditionTrue,
+					Message: "exceeded quota",
+				}}
+			}),
+			wantState:   RolloutProgressing,
+			wantMessage: "exceeded quota",
+		},
+		{
+			name: "controller 未处理最新版本时忽略上一次发布的 condition",
+			deploy: newDeploy(func(d *appsv1.Deployment) {
+				d.Generation = 3
+				d.Status.Conditions = []appsv1.DeploymentCondition{{
+					Type:    appsv1.DeploymentProgressing,
+					Status:  corev1.ConditionFalse,
+					Reason:  "ProgressDeadlineExceeded",
+					Message: "old rollout timed out",
+				}}
+			}),
+			wantState: RolloutProgressing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, message := rolloutState(tt.deploy)
+			if state != tt.wantState || message != tt.wantMessage {
+				t.Errorf("rolloutState() = %s, %q, want %s, %q", state, message, tt.wantState, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestNewDeploymentSummary(t *testing.T) {
+	d := newTestDeployment("web", "default", 3)
+	d.CreationTimestamp = metav1.NewTime(time.Now().Add(-3 * 24 * time.Hour))
+	d.Annotations = map[string]string{deploymentRevisionAnnotation: "7"}
+	d.Status = appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 2, AvailableReplicas: 2, UnavailableReplicas: 1}
+
+	summary := newDeploymentSummary(d, time.Now())
+	if summary.Ready != "2/3" || summary.Status != DeploymentUnavailable || summary.RolloutState != RolloutProgressing {
+		t.Errorf("newDeploymentSummary() = %+v", summary)
+	}
+	if summary.Revision != 7 || summary.Age != "3d" || len(summary.Images) != 1 || summary.Images[0] != "nginx:1.25" {
+		t.Errorf("newDeploymentSummary() = %+v", summary)
+	}
+}
@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestDeployment 构造测试用 deployment，容器名与 deployment 同名
+func newTestDeployment(name, namespace string, replicas int32) *appsv1.Deployment {
+	labels := map[string]string{"app": name}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: name, Image: "nginx:1.25"}},
+				},
+			},
+		},
+	}
+}
+
+// newScaleClient 创建支持 scale 子资源的 fake clientset
+// fake 的 object tracker 不处理子资源，这里将 scale 的读写映射到 deployment 的 spec.replicas 上
+func newScaleClient(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		if get.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		deploy, err := client.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		return true, &autoscalingv1.Scale{
+			ObjectMeta: metav1.ObjectMeta{Name: get.GetName(), Namespace: get.GetNamespace()},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: *deploy.(*appsv1.Deployment).Spec.Replicas},
+		}, nil
+	})
+	client.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		update := action.(k8stesting.UpdateAction)
+		if update.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		scale := update.GetObject().(*autoscalingv1.Scale)
+		gvr := appsv1.SchemeGroupVersion.WithResource("deployments")
+		obj, err := client.Tracker().Get(gvr, update.GetNamespace(), scale.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		deploy := obj.(*appsv1.Deployment)
+		deploy.Spec.Replicas = &scale.Spec.Replicas
+		if err := client.Tracker().Update(gvr, deploy, update.GetNamespace()); err != nil {
+			return true, nil, err
+		}
+		return true, scale, nil
+	})
+	return client
+}
+
+func TestScaleDeployment(t *testing.T) {
+	tests := []struct {
+		name           string
+		deploymentName string
+		scaleNum       int
+		wantReplicas   int32
+		wantErr        bool
+	}{
+		{name: "扩容", deploymentName: "nginx", scaleNum: 5, wantReplicas: 5},
+		{name: "缩容到 0", deploymentName: "nginx", scaleNum: 0, wantReplicas: 0},
+		{name: "deployment 不存在", deploymentName: "missing", scaleNum: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newScaleClient(newTestDeployment("nginx", "default", 2))
+			replicas, err := Deployment.ScaleDeployment(client, tt.deploymentName, "default", tt.scaleNum)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ScaleDeployment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if replicas != tt.wantReplicas {
+				t.Errorf("ScaleDeployment() = %d, want %d", replicas, tt.wantReplicas)
+			}
+			deploy, err := client.AppsV1().Deployments("default").Get(context.TODO(), tt.deploymentName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("获取Deployment失败, %v", err)
+			}
+			if *deploy.Spec.Replicas != tt.wantReplicas {
+				t.Errorf("spec.replicas = %d, want %d", *deploy.Spec.Replicas, tt.wantReplicas)
+			}
+		})
+	}
+}
+
+func TestRestartDeployment(t *testing.T) {
+	// 容器名与 deployment 名不同的 deployment
+	sidecar := newTestDeployment("api", "default", 1)
+	sidecar.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "api:1.0"}, {Name: "envoy", Image: "envoy:1.26"}}
+	paused := newTestDeployment("paused", "default", 1)
+	paused.Spec.Paused = true
+
+	tests := []struct {
+		name           string
+		deploymentName string
+		wantContainers int
+		wantErr        bool
+	}{
+		{name: "重启存在的 deployment", deploymentName: "nginx", wantContainers: 1},
+		{name: "容器名与 deployment 不同", deploymentName: "api", wantContainers: 2},
+		{name: "暂停的 deployment", deploymentName: "paused", wantErr: true},
+		{name: "deployment 不存在", deploymentName: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(newTestDeployment("nginx", "default", 1), sidecar.DeepCopy(), paused.DeepCopy())
+			err := Deployment.RestartDeployment(client, tt.deploymentName, "default")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RestartDeployment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			deploy, err := client.AppsV1().Deployments("default").Get(context.TODO(), tt.deploymentName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("获取Deployment失败, %v", err)
+			}
+			if _, err := time.Parse(time.RFC3339, deploy.Spec.Template.Annotations[restartedAtAnnotation]); err != nil {
+				t.Errorf("pod 模板未设置 %s 注解, annotations = %v", restartedAtAnnotation, deploy.Spec.Template.Annotations)
+			}
+			// 不修改容器
+			containers := deploy.Spec.Template.Spec.Containers
+			if len(containers) != tt.wantContainers {
+				t.Fatalf("got %d containers, want %d", len(containers), tt.wantContainers)
+			}
+			for _, container := range containers {
+				if len(container.Env) != 0 {
+					t.Errorf("容器 %s 不应被修改, env = %v", container.Name, container.Env)
+				}
+			}
+		})
+	}
+}
+
+func TestSetImage(t *testing.T) {
+	newDeploy := func() *appsv1.Deployment {
+		deploy := newTestDeployment("api", "default", 1)
+		deploy.Spec.Template.Spec.InitContainers = []corev1.Container{{Name: "migrate", Image: "api-migrate:1.0"}}
+		deploy.Spec.Template.Spec.Containers = []corev1.Container{
+			{Name: "app", Image: "api:1.0", Ports: []corev1.ContainerPort{{ContainerPort: 8080}}},
+			{Name: "envoy", Image: "envoy:1.26"},
+		}
+		return deploy
+	}
+
+	tests := []struct {
+		name            string
+		images          map[string]string
+		changeCause     string
+		wantImages      map[string]string
+		wantChangeCause string
+		wantErr         bool
+	}{
+		{
+			name:            "更新容器和 init 容器",
+			images:          map[string]string{"app": "api:1.1", "migrate": "api-migrate:1.1"},
+			wantImages:      map[string]string{"migrate": "api-migrate:1.1", "app": "api:1.1", "envoy": "envoy:1.26"},
+			wantChangeCause: "set image app=api:1.1 migrate=api-migrate:1.1",
+		},
+		{
+			name:            "指定变更原因",
+			images:          map[string]string{"envoy": "envoy:1.27"},
+			changeCause:     "升级 envoy",
+			wantImages:      map[string]string{"migrate": "api-migrate:1.0", "app": "api:1.0", "envoy": "envoy:1.27"},
+			wantChangeCause: "升级 envoy",
+		},
+		{name: "容器不存在", images: map[string]string{"api": "api:1.1"}, wantErr: true},
+		{name: "镜像为空", images: map[string]string{"app": ""}, wantErr: true},
+		{name: "未指定镜像", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(newDeploy())
+			err := Deployment.SetImage(client, "api", "default", tt.images, tt.changeCause)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			deploy, err := client.AppsV1().Deployments("default").Get(context.TODO(), "api", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("获取Deployment失败, %v", err)
+			}
+			spec := deploy.Spec.Template.Spec
+			got := map[string]string{}
+			for _, container := range append(spec.InitContainers, spec.Containers...) {
+				got[container.Name] = container.Image
+			}
+			if len(got) != len(tt.wantImages) || len(spec.Containers) != 2 {
+				t.Fatalf("SetImage() 后的容器 = %v", got)
+			}
+			for name, image := range tt.wantImages {
+				if got[name] != image {
+					t.Errorf("容器 %s 的镜像 = %s, want %s", name, got[name], image)
+				}
+			}
+			// 其他字段保持不变
+			if len(spec.Containers[0].Ports) != 1 {
+				t.Errorf("容器 app 的端口被修改, ports = %v", spec.Containers[0].Ports)
+			}
+			if cause := deploy.Annotations[changeCauseAnnotation]; cause != tt.wantChangeCause {
+				t.Errorf("change-cause = %q, want %q", cause, tt.wantChangeCause)
+			}
+		})
+	}
+}
+
+func TestSetImageWaitAfterStalled(t *testing.T) {
+	// 上一次发布超过期限，更新镜像修复后等待新的发布完成
+	deploy := newTestDeployment("api", "default", 1)
+	deploy.Generation, deploy.Status.ObservedGeneration = 1, 1
+	deploy.Status.Replicas, deploy.Status.UpdatedReplicas = 2, 1
+	deploy.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type:    appsv1.DeploymentProgressing,
+		Reason:  "ProgressDeadlineExceeded",
+		Message: "old rollout timed out",
+	}}
+	client := fake.NewSimpleClientset(deploy)
+	if err := Deployment.SetImage(client, "api", "default", map[string]string{"api": "api:1.1"}, ""); err != nil {
+		t.Fatalf("SetImage() error = %v", err)
+	}
+	// 模拟 apiserver 在 spec 变化时递增 generation
+	deploy, _ = client.AppsV1().Deployments("default").Get(context.TODO(), "api", metav1.GetOptions{})
+	deploy.Generation = 2
+	_, _ = client.AppsV1().Deployments("default").Update(context.TODO(), deploy, metav1.UpdateOptions{})
+
+	done := make(chan struct{})
+	defer close(done)
+	var states []string
+	status, err := Deployment.WatchRolloutStatus(context.Background(), client, "api", "default", 0, func(status *RolloutStatus) error {
+		states = append(states, status.State)
+		if len(states) > 1 {
+			return nil
+		}
+		// 模拟 controller 处理新的 spec 并完成发布，watch 建立前的更新可能丢失，持续更新直到结束
+		go func() {
+			deploy := deploy.DeepCopy()
+			deploy.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(20 * time.Millisecond):
+					_, _ = client.AppsV1().Deployments("default").Update(context.TODO(), deploy, metav1.UpdateOptions{})
+				}
+			}
+		}()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WatchRolloutStatus() error = %v", err)
+	}
+	if status.State != RolloutComplete || len(states) != 2 || states[0] != RolloutProgressing {
+		t.Errorf("WatchRolloutStatus() = %+v, states = %v", status, states)
+	}
+}
+
+func TestPauseResumeDeployment(t *testing.T) {
+	client := fake.NewSimpleClientset(newTestDeployment("nginx", "default", 1))
+	paused := func() bool {
+		deploy, err := client.AppsV1().Deployments("default").Get(context.TODO(), "nginx", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("获取Deployment失败, %v", err)
+		}
+		return deploy.Spec.Paused
+	}
+
+	tests := []struct {
+		name       string
+		action     func(client kubernetes.Interface, deploymentName, namespace string) error
+		wantPaused bool
+		wantErr    bool
+	}{
+		{name: "暂停", action: Deployment.PauseDeployment, wantPaused: true},
+		{name: "重复暂停", action: Deployment.PauseDeployment, wantPaused: true, wantErr: true},
+		{name: "恢复", action: Deployment.ResumeDeployment, wantPaused: false},
+		{name: "重复恢复", action: Deployment.ResumeDeployment, wantPaused: false, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.action(client, "nginx", "default")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := paused(); got != tt.wantPaused {
+				t.Errorf("spec.paused = %v, want %v", got, tt.wantPaused)
+			}
+		})
+	}
+	if err := Deployment.PauseDeployment(client, "missing", "default"); err == nil {
+		t.Errorf("PauseDeployment() deployment 不存在时应返回错误")
+	}
+}
+
+func TestCreateDeployment(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    *DeployCreate
+		wantErr bool
+	}{
+		{
+			name: "创建不带健康检查的 deployment",
+			data: &DeployCreate{
+				Name: "web", Namespace: "default", Replicas: 2, Image: "nginx:1.25",
+				Label: map[string]string{"app": "web"}, Cpu: "500m", Memory: "256Mi", ContainerPort: 8080,
+			},
+		},
+		{
+			name: "创建带健康检查的 deployment",
+			data: &DeployCreate{
+				Name: "api", Namespace: "default", Replicas: 1, Image: "api:v1",
+				Label: map[string]string{"app": "api"}, Cpu: "1", Memory: "1Gi", ContainerPort: 8080,
+				HealthCheck: true, HealthPath: "/healthz",
+			},
+		},
+		{
+			name: "deployment 已存在",
+			data: &DeployCreate{
+				Name: "exists", Namespace: "default", Replicas: 1, Image: "nginx:1.25",
+				Label: map[string]string{"app": "exists"}, Cpu: "100m", Memory: "64Mi",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(newTestDeployment("exists", "default", 1))
+			err := Deployment.CreateDeployment(client, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateDeployment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			deploy, err := client.AppsV1().Deployments(tt.data.Namespace).Get(context.TODO(), tt.data.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("获取Deployment失败, %v", err)
+			}
+			if *deploy.Spec.Replicas != tt.data.Replicas {
+				t.Errorf("spec.replicas = %d, want %d", *deploy.Spec.Replicas, tt.data.Replicas)
+			}
+			container := deploy.Spec.Template.Spec.Containers[0]
+			if container.Image != tt.data.Image {
+				t.Errorf("image = %s, want %s", container.Image, tt.data.Image)
+			}
+			if got := container.Resources.Limits.Cpu().String(); got != tt.data.Cpu {
+				t.Errorf("cpu limit = %s, want %s", got, tt.data.Cpu)
+			}
+			if got := container.Resources.Requests.Memory().String(); got != tt.data.Memory {
+				t.Errorf("memory request = %s, want %s", got, tt.data.Memory)
+			}
+			if len(container.Ports) != 1 || container.Ports[0].ContainerPort != tt.data.ContainerPort {
+				t.Errorf("ports = %v, want %d", container.Ports, tt.data.ContainerPort)
+			}
+			if tt.data.HealthCheck {
+				if container.ReadinessProbe == nil || container.LivenessProbe == nil {
+					t.Fatalf("健康检查未生效")
+				}
+				if container.ReadinessProbe.HTTPGet.Path != tt.data.HealthPath {
+					t.Errorf("readiness path = %s, want %s", container.ReadinessProbe.HTTPGet.Path, tt.data.HealthPath)
+				}
+				if container.LivenessProbe.HTTPGet.Port.IntVal != tt.data.ContainerPort {
+					t.Errorf("liveness port = %d, want %d", container.LivenessProbe.HTTPGet.Port.IntVal, tt.data.ContainerPort)
+				}
+			} else if container.ReadinessProbe != nil || container.LivenessProbe != nil {
+				t.Errorf("未开启健康检查但设置了探针")
+			}
+		})
+	}
+}
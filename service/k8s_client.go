@@ -1,56 +1,145 @@
 package service
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/wonderivan/logger"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"kubeadm-platform/config"
 )
 
-var K8s k8s
+var K8s = k8s{NewClient: newClientFromKubeconfig}
+
+// ClientFactory 根据 kubeconfig 文件路径创建 client 和 rest 配置，测试时可替换为返回 fake clientset 的实现
+type ClientFactory func(kubeconfig string) (kubernetes.Interface, *rest.Config, error)
 
 type k8s struct {
+	// 保护以下 map 的并发读写，集群可在运行时增删改
+	mu sync.RWMutex
 	// 提供多集群 client
-	ClientMap map[string]*kubernetes.Clientset
-	// 提供集群列表功能
+	ClientMap map[string]kubernetes.Interface
+	// 与 ClientMap 对应的 rest 配置，exec 等需要 SPDY 升级的请求使用
+	ConfMap map[string]*rest.Config
+	// 提供集群列表功能，集群名 -> kubeconfig 路径，包含初始化失败的集群
 	KubeConfMap map[string]string
+	// 初始化失败的集群及原因
+	ErrMap map[string]string
+	// 创建 client 的工厂方法
+	NewClient ClientFactory
+	// 健康检查时单个集群的超时时间，为 0 时使用 config.ClusterProbeTimeout
+	ProbeTimeout time.Duration
+
+	// 集群注册表的来源路径，为文件时运行时的修改会写回该文件
+	source string
+	// 来源文件中的集群，不包含环境变量注册的集群
+	registry map[string]string
+	// 环境变量注册的集群，只能通过环境变量修改
+	envClusters map[string]bool
+	// 集群最近一次探测的结果
+	healthMap map[string]ClusterHealth
+}
+
+// newClientFromKubeconfig 默认的 client 工厂，读取 kubeconfig 文件创建 clientset
+func newClientFromKubeconfig(kubeconfig string) (kubernetes.Interface, *rest.Config, error) {
+	conf, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("创建K8s配置失败 %v", err))
+	}
+	clientSet, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("创建K8sClient失败 %v", err))
+	}
+	return clientSet, conf, nil
 }
 
 // GetClient 根据集群名获取 client
-func (k *k8s) GetClient(cluster string) (*kubernetes.Clientset, error) {
+func (k *k8s) GetClient(cluster string) (kubernetes.Interface, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	client, ok := k.ClientMap[cluster]
 	if !ok {
+		if reason, broken := k.ErrMap[cluster]; broken {
+			return nil, errors.New(fmt.Sprintf("集群:%s初始化失败，无法获取client, %s", cluster, reason))
+		}
 		return nil, errors.New(fmt.Sprintf("集群:%s不存在，无法获取client", cluster))
 	}
 	return client, nil
 }
 
+// GetRestConfig 根据集群名获取 rest 配置，exec 等需要 SPDY 升级的请求使用
+// 返回注册集群时创建的配置的副本，调用方可以修改
+func (k *k8s) GetRestConfig(cluster string) (*rest.Config, error) {
+	if _, err := k.GetClient(cluster); err != nil {
+		return nil, err
+	}
+	k.mu.RLock()
+	conf, ok := k.ConfMap[cluster]
+	k.mu.RUnlock()
+	if !ok || conf == nil {
+		return nil, errors.New(fmt.Sprintf("集群:%s没有rest配置", cluster))
+	}
+	return rest.CopyConfig(conf), nil
+}
+
 // Init 初始化 client
+// 从注册表文件或目录加载集群，环境变量中的集群覆盖同名配置
+// 单个集群初始化失败只记录错误，不影响其他集群
 func (k *k8s) Init() {
-	mp := make(map[string]string, 0)
-	k.ClientMap = make(map[string]*kubernetes.Clientset, 0)
-	// 反序列化
-	if err := json.Unmarshal([]byte(config.Kubeconfigs), &mp); err != nil {
-		panic(fmt.Sprintf("Kubeconfigs反序列化失败 %v\n", err))
+	source := config.ClusterConfigPath
+	if path := os.Getenv(config.ClusterConfigPathEnv); path != "" {
+		source = path
+	}
+	registry, err := loadClusterRegistry(source)
+	if err != nil {
+		registry = make(map[string]string)
+		// 注册表存在但无法读取时不写回，避免运行时的修改覆盖原有的集群
+		if _, statErr := os.Stat(source); !os.IsNotExist(statErr) {
+			logger.Error(fmt.Sprintf("加载集群注册表失败，运行时修改不会写回, %v", err))
+			source = ""
+		} else {
+			logger.Error(fmt.Sprintf("加载集群注册表失败, %v", err))
+		}
+	}
+	mp := make(map[string]string, len(registry))
+	for name, kubeconfig := range registry {
+		mp[name] = kubeconfig
+	}
+	envClusters := make(map[string]bool)
+	for name, kubeconfig := range loadClusterEnv() {
+		mp[name] = kubeconfig
+		envClusters[name] = true
 	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.NewClient == nil {
+		k.NewClient = newClientFromKubeconfig
+	}
+	k.source = source
+	k.registry = registry
+	k.envClusters = envClusters
 	k.KubeConfMap = mp
+	k.ClientMap = make(map[string]kubernetes.Interface, len(mp))
+	k.ConfMap = make(map[string]*rest.Config, len(mp))
+	k.ErrMap = make(map[string]string)
 
 	// 初始化 client
 	for key, value := range mp {
-		conf, err := clientcmd.BuildConfigFromFlags("", value)
-		if err != nil {
-			panic(fmt.Sprintf("集群%s:创建K8s配置失败 %v", key, err))
-		}
-		clientSet, err := kubernetes.NewForConfig(conf)
+		clientSet, conf, err := k.NewClient(value)
 		if err != nil {
-			panic(fmt.Sprintf("集群%s:创建K8sClient失败 %v", key, err))
+			logger.Error(fmt.Sprintf("集群%s:%v", key, err))
+			k.ErrMap[key] = err.Error()
+			continue
 		}
 		k.ClientMap[key] = clientSet
+		k.ConfMap[key] = conf
 		logger.Info(fmt.Sprintf("集群%s:创建K8sClient成功", key))
 	}
 }
@@ -7,10 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/wonderivan/logger"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 
 	"kubeadm-platform/config"
@@ -21,79 +24,181 @@ var Pod pod
 type pod struct {
 }
 
-// PodsResp 定义列表的返回类型
+// PodsResp 定义列表的返回类型，列表只返回摘要，完整对象通过详情接口获取
 type PodsResp struct {
-	Items []corev1.Pod `json:"items"`
+	Items []PodSummary `json:"items"`
 	Total int          `json:"total"`
+	// Cache 数据来源及新鲜度
+	Cache *CacheStatus `json:"cache"`
+	// Cursor 游标分页时下一页的游标，为空表示没有下一页
+	Cursor string `json:"cursor,omitempty"`
+	// Remaining 游标分页时 apiserver 估算的剩余数量（未计入内存过滤），apiserver 未返回时为空
+	Remaining *int64 `json:"remaining,omitempty"`
 }
 
-// 从 Pod 类型转到 DataCell 类型
-func (p *pod) toCells(std []corev1.Pod) []DataCell {
-	cells := make([]DataCell, len(std))
-	for i := range std {
-		cells[i] = podCell(std[i])
-	}
-	return cells
+// podAccessor 定义 pod 列表过滤、排序使用的字段
+var podAccessor = &Accessor[corev1.Pod]{
+	Name:      func(p *corev1.Pod) string { return p.Name },
+	Creation:  func(p *corev1.Pod) time.Time { return p.CreationTimestamp.Time },
+	Namespace: func(p *corev1.Pod) string { return p.Namespace },
+	Labels:    func(p *corev1.Pod) map[string]string { return p.Labels },
+	// 与 apiserver 支持的 pod 字段选择器保持一致
+	Fields: func(p *corev1.Pod) fields.Set {
+		return fields.Set{
+			"metadata.name":            p.Name,
+			"metadata.namespace":       p.Namespace,
+			"spec.nodeName":            p.Spec.NodeName,
+			"spec.restartPolicy":       string(p.Spec.RestartPolicy),
+			"spec.schedulerName":       p.Spec.SchedulerName,
+			"spec.serviceAccountName":  p.Spec.ServiceAccountName,
+			"status.phase":             string(p.Status.Phase),
+			"status.podIP":             p.Status.PodIP,
+			"status.nominatedNodeName": p.Status.NominatedNodeName,
+		}
+	},
+	Status:   func(p *corev1.Pod) string { return string(p.Status.Phase) },
+	NodeName: func(p *corev1.Pod) string { return p.Spec.NodeName },
+	Images:   func(p *corev1.Pod) []string { return containerImages(&p.Spec) },
+	SortFields: map[string]func(*corev1.Pod) interface{}{
+		SortByName:      func(p *corev1.Pod) interface{} { return p.Name },
+		SortByCreation:  func(p *corev1.Pod) interface{} { return p.CreationTimestamp.Time },
+		SortByNamespace: func(p *corev1.Pod) interface{} { return p.Namespace },
+		SortByRestarts: func(p *corev1.Pod) interface{} {
+			var restarts int64
+			for _, status := range p.Status.ContainerStatuses {
+				restarts += int64(status.RestartCount)
+			}
+			return restarts
+		},
+		SortByReady: func(p *corev1.Pod) interface{} {
+			var ready int64
+			for _, status := range p.Status.ContainerStatuses {
+				if status.Ready {
+					ready++
+				}
+			}
+			return ready
+		},
+		SortByCPU:    func(p *corev1.Pod) interface{} { return sumRequests(p.Spec.Containers, corev1.ResourceCPU) },
+		SortByMemory: func(p *corev1.Pod) interface{} { return sumRequests(p.Spec.Containers, corev1.ResourceMemory) },
+	},
 }
 
-// 从 DataCell 类型转到 pod 类型
-func (p *pod) fromCells(cells []DataCell) []corev1.Pod {
-	pods := make([]corev1.Pod, len(cells))
-	for i := range cells {
-		pods[i] = corev1.Pod(cells[i].(podCell))
+// listPods 获取 pod 列表，useCache 为 true 时优先读取 informer 缓存，缓存不可用时回退到 apiserver
+// 访问 apiserver 时将标签和字段选择器下推到 ListOptions，缓存数据由 Selector 在内存中过滤
+func (p *pod) listPods(client kubernetes.Interface, namespace string, filter *FilterQuery, useCache bool) ([]corev1.Pod, *CacheStatus, error) {
+	if useCache && config.InformerCacheEnabled {
+		objs, status, err := Cache.List(client, cacheResourcePods, namespace)
+		if err == nil {
+			pods := make([]corev1.Pod, len(objs))
+			for i := range objs {
+				pods[i] = *objs[i].(*corev1.Pod)
+			}
+			return pods, status, nil
+		}
+		logger.Warn(fmt.Sprintf("读取Pod缓存失败，回退到apiserver, %v", err))
 	}
-	return pods
-}
-
-// GetPods 获取 pod 列表
-func (p *pod) GetPods(client *kubernetes.Clientset, fileterName, namespace string, limit, page int) (podsResp *PodsResp, err error) {
 	// client 用于选择哪个集群
 	// context.TODO() 用于声明一个空的 context 上下文，用于 List 方法内设置这个请求的超时（源码），这里的常用用法
 	// metav1.ListOptions{} 用于过滤 List 数据，如使用 label , field 等
-	podList, err := client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+	podList, err := client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: filter.LabelSelector,
+		FieldSelector: filter.FieldSelector,
+	})
 	if err != nil {
-		logger.Error(fmt.Sprintf("获取Pod列表失败, %v\n", err))
-		return nil, errors.New(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+		return nil, nil, err
 	}
+	return podList.Items, apiServerStatus, nil
+}
 
-	// 实例化 dataSelector 对象
-	selectableData := &dataSelector{
-		GenericDataList: p.toCells(podList.Items),
-		dataSelectorQuery: &DataSelectorQuery{
-			FilterQuery: &FilterQuery{Name: fileterName},
-			PaginateQuery: &PaginateQuery{
-				Limit: limit,
-				Page:  page,
-			},
-		},
+// GetPods 获取 pod 列表
+func (p *pod) GetPods(client kubernetes.Interface, namespace string, query *DataSelectorQuery, useCache bool) (podsResp *PodsResp, err error) {
+	if query.PaginateQuery != nil && query.PaginateQuery.CursorMode {
+		// 先校验查询条件再访问 apiserver
+		if err = query.compile(podAccessor.sortableFields()); err != nil {
+			logger.Error(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+			return nil, errors.New(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+		}
+		return p.getPodsByCursor(client, namespace, query)
 	}
+	pods, total, status, err := p.selectPods(client, namespace, query, useCache)
+	if err != nil {
+		return nil, err
+	}
+	return &PodsResp{
+		Items: toPodSummaries(pods),
+		Total: total,
+		Cache: status,
+	}, nil
+}
 
-	// 先过滤
-	filtered := selectableData.Filter()
-	total := len(filtered.GenericDataList)
+// selectPods 获取过滤、排序、分页后的完整 pod 对象及过滤后的总数
+func (p *pod) selectPods(client kubernetes.Interface, namespace string, query *DataSelectorQuery, useCache bool) ([]corev1.Pod, int, *CacheStatus, error) {
+	// 先校验查询条件再访问 apiserver
+	if err := query.compile(podAccessor.sortableFields()); err != nil {
+		logger.Error(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+		return nil, 0, nil, errors.New(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+	}
+	podList, status, err := p.listPods(client, namespace, query.FilterQuery, useCache)
+	if err != nil {
+		logger.Error(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+		return nil, 0, nil, errors.New(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+	}
+
+	// 实例化 Selector 对象，先过滤
+	filtered := NewSelector(podList, query, podAccessor).Filter()
+	total := filtered.Len()
 	// 再排序和分页
-	data := filtered.Sort().Paginate()
-	// 将 []DataCell 类型的 pod 列表转为 v1.pod 列表
-	pods := p.fromCells(data.GenericDataList)
+	return filtered.Sort().Paginate().Items(), total, status, nil
+}
 
+// getPodsByCursor 使用 apiserver 的 limit/continue 游标分页获取 pod 列表，不读取缓存
+// 名称等无法下推的过滤条件只在当前页内生效，因此一页的数量可能少于 limit
+func (p *pod) getPodsByCursor(client kubernetes.Interface, namespace string, query *DataSelectorQuery) (*PodsResp, error) {
+	opts, err := query.cursorListOptions()
+	if err != nil {
+		logger.Error(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+		return nil, errors.New(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+	}
+	list, err := client.CoreV1().Pods(namespace).List(context.TODO(), opts)
+	if err != nil {
+		err = cursorListError(err)
+		logger.Error(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+		return nil, errors.New(fmt.Sprintf("获取Pod列表失败, %v\n", err))
+	}
+	items := NewSelector(list.Items, query, podAccessor).Filter().Items()
 	return &PodsResp{
-		Items: pods,
-		Total: total,
+		Items:     toPodSummaries(items),
+		Total:     len(items),
+		Cache:     apiServerStatus,
+		Cursor:    encodeCursor(list.Continue),
+		Remaining: list.RemainingItemCount,
 	}, nil
 }
 
-// GetPodDetail 获取 pod 详情
-func (p *pod) GetPodDetail(client *kubernetes.Clientset, podName, namespace string) (pod *corev1.Pod, err error) {
+// GetPodDetail 获取 pod 详情，useCache 为 true 时优先读取 informer 缓存
+func (p *pod) GetPodDetail(client kubernetes.Interface, podName, namespace string, useCache bool) (pod *corev1.Pod, status *CacheStatus, err error) {
+	if useCache && config.InformerCacheEnabled {
+		obj, status, err := Cache.Get(client, cacheResourcePods, namespace, podName)
+		if err == nil {
+			return obj.(*corev1.Pod).DeepCopy(), status, nil
+		}
+		if apierrors.IsNotFound(err) {
+			logger.Error(fmt.Sprintf("获取Pod详情失败, %v\n", err))
+			return nil, nil, errors.New(fmt.Sprintf("获取Pod详情失败, %v\n", err))
+		}
+		logger.Warn(fmt.Sprintf("读取Pod缓存失败，回退到apiserver, %v", err))
+	}
 	pod, err = client.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
 	if err != nil {
 		logger.Error(fmt.Sprintf("获取Pod详情失败, %v\n", err))
-		return nil, errors.New(fmt.Sprintf("获取Pod详情失败, %v\n", err))
+		return nil, nil, errors.New(fmt.Sprintf("获取Pod详情失败, %v\n", err))
 	}
-	return pod, nil
+	return pod, apiServerStatus, nil
 }
 
 // DeletePod 删除 pod
-func (p *pod) DeletePod(client *kubernetes.Clientset, podName, namespace string) (err error) {
+func (p *pod) DeletePod(client kubernetes.Interface, podName, namespace string) (err error) {
 	err = client.CoreV1().Pods(namespace).Delete(context.TODO(), podName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(fmt.Sprintf("删除Pod失败, %v\n", err))
@@ -103,7 +208,7 @@ func (p *pod) DeletePod(client *kubernetes.Clientset, podName, namespace string)
 }
 
 // UpdatePod 更新pod
-func (p *pod) UpdatePod(client *kubernetes.Clientset, namespace, content string) (err error) {
+func (p *pod) UpdatePod(client kubernetes.Interface, namespace, content string) (err error) {
 	// content 就是 pod 的整个 json 体
 	// content 转成 pod 结构体
 	var pod = &corev1.Pod{}
@@ -123,9 +228,9 @@ func (p *pod) UpdatePod(client *kubernetes.Clientset, namespace, content string)
 }
 
 // GetPodContainer 获取 pod 中的容器名
-func (p *pod) GetPodContainer(client *kubernetes.Clientset, podName, namespace string) (containers []string, err error) {
+func (p *pod) GetPodContainer(client kubernetes.Interface, podName, namespace string) (containers []string, err error) {
 	// 获取 pod 详情
-	pod, err := p.GetPodDetail(client, podName, namespace)
+	pod, _, err := p.GetPodDetail(client, podName, namespace, true)
 	if err != nil {
 		return nil, err
 	}
@@ -137,12 +242,26 @@ func (p *pod) GetPodContainer(client *kubernetes.Clientset, podName, namespace s
 }
 
 // GetPodLog 获取 pod 中的容器日志
-func (p *pod) GetPodLog(client *kubernetes.Clientset, containerName, podName, namespace string) (log string, err error) {
-	// 设置日志的配置，容器名以及 tail 的行数
-	lineLimit := int64(config.PodLogTailLine)
-	option := &corev1.PodLogOptions{
-		Container: containerName,
-		TailLines: &lineLimit,
+// 最多从 apiserver 读取 config.PodLogMaxReadBytes 字节，返回其中最后的不超过 config.PodLogMaxBytes 字节的完整行
+// truncated 表示日志因字节上限被截断，limit_bytes 限制的部分不算截断
+func (p *pod) GetPodLog(client kubernetes.Interface, podName, namespace string, query *PodLogQuery) (log string, truncated bool, err error) {
+	return p.getPodLogTail(client, podName, namespace, query, config.PodLogMaxBytes)
+}
+
+// getPodLogTail 获取容器日志，只返回最后的不超过 maxBytes 字节的完整行
+func (p *pod) getPodLogTail(client kubernetes.Interface, podName, namespace string, query *PodLogQuery, maxBytes int) (log string, truncated bool, err error) {
+	// 设置日志的配置，容器名以及 tail 的行数等
+	option, err := query.logOptions(config.PodLogTailLine)
+	if err != nil {
+		logger.Error(fmt.Sprintf("获取PodLog失败, %v\n", err))
+		return "", false, errors.New(fmt.Sprintf("获取PodLog失败, %v\n", err))
+	}
+	// 未指定 limit_bytes 或超过读取上限时，由 apiserver 按读取上限截断，多读一个字节用于判断是否被截断
+	readLimit := int64(config.PodLogMaxReadBytes)
+	capped := option.LimitBytes == nil || *option.LimitBytes > readLimit
+	if capped {
+		requestLimit := readLimit + 1
+		option.LimitBytes = &requestLimit
 	}
 	// 获取 request 实例
 	req := client.CoreV1().Pods(namespace).GetLogs(podName, option)
@@ -150,15 +269,20 @@ func (p *pod) GetPodLog(client *kubernetes.Clientset, containerName, podName, na
 	podLogs, err := req.Stream(context.TODO())
 	if err != nil {
 		logger.Error(fmt.Sprintf("获取PodLog失败, %v\n", err))
-		return "", errors.New(fmt.Sprintf("获取PodLog失败, %v\n", err))
+		return "", false, errors.New(fmt.Sprintf("获取PodLog失败, %v\n", err))
 	}
 	defer podLogs.Close()
-	// 将 response body 写入缓冲区，目的是为了转成 string 返回
-	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, podLogs)
+	// apiserver 之外再限制一次读取的字节数，读取时只在内存中保留最后 maxBytes 字节左右的日志
+	reader := &countingReader{r: io.LimitReader(podLogs, *option.LimitBytes)}
+	content, truncated, err := readLogTail(reader, maxBytes)
 	if err != nil {
 		logger.Error(fmt.Sprintf("复制PodLog失败, %v\n", err))
-		return "", errors.New(fmt.Sprintf("复制PodLog失败, %v\n", err))
+		return "", false, errors.New(fmt.Sprintf("复制PodLog失败, %v\n", err))
+	}
+	if capped && reader.n > readLimit {
+		// 达到读取上限，丢弃最后不完整的一行
+		content = content[:bytes.LastIndexByte(content, '\n')+1]
+		truncated = true
 	}
-	return buf.String(), nil
+	return string(content), truncated, nil
 }
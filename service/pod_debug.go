@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wonderivan/logger"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"kubeadm-platform/config"
+)
+
+// PodDebug 通过 ephemeralcontainers 子资源向运行中的 pod 添加临时调试容器，用于没有 shell 的镜像
+var PodDebug = podDebug{ReadyTimeout: config.DebugContainerReadyTimeout}
+
+type podDebug struct {
+	// 等待调试容器运行的超时时间
+	ReadyTimeout time.Duration
+}
+
+// DebugOptions 定义临时调试容器的参数
+type DebugOptions struct {
+	Namespace string
+	PodName   string
+	// Name 调试容器名，为空时自动生成
+	Name string
+	// Image 调试镜像，为空时使用 config.DebugImage
+	Image string
+	// TargetContainer 共享进程命名空间的目标容器，为空时不共享
+	TargetContainer string
+	// Command 调试容器的启动命令，为空时使用镜像默认命令
+	Command []string
+}
+
+// debugPollInterval 检查调试容器状态的间隔
+const debugPollInterval = time.Second
+
+// CreateDebugContainer 向 pod 添加临时调试容器，等待容器运行后返回容器名
+// 调试容器分配 TTY 并打开 stdin，可以直接用于 exec 或 attach
+func (d *podDebug) CreateDebugContainer(client kubernetes.Interface, opts *DebugOptions) (string, error) {
+	// 临时容器只能追加，需基于 apiserver 中的最新版本更新
+	pod, _, err := Pod.GetPodDetail(client, opts.PodName, opts.Namespace, false)
+	if err != nil {
+		return "", err
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return "", errors.New(fmt.Sprintf("Pod:%s当前状态为%s，无法添加调试容器", opts.PodName, pod.Status.Phase))
+	}
+	names := make(map[string]bool)
+	for _, container := range pod.Spec.Containers {
+		names[container.Name] = true
+	}
+	for _, container := range pod.Spec.InitContainers {
+		names[container.Name] = true
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		names[container.Name] = true
+	}
+	if opts.TargetContainer != "" && !containsContainer(pod.Spec.Containers, opts.TargetContainer) {
+		return "", errors.New(fmt.Sprintf("容器:%s在Pod:%s中不存在", opts.TargetContainer, opts.PodName))
+	}
+	name := opts.Name
+	if name == "" {
+		for name == "" || names[name] {
+			name = "debugger-" + utilrand.String(5)
+		}
+	} else if names[name] {
+		return "", errors.New(fmt.Sprintf("容器:%s在Pod:%s中已存在", name, opts.PodName))
+	}
+	image := opts.Image
+	if image == "" {
+		image = config.DebugImage
+	}
+
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    image,
+			Command:                  opts.Command,
+			ImagePullPolicy:          corev1.PullIfNotPresent,
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		},
+		TargetContainerName: opts.TargetContainer,
+	})
+	_, err = client.CoreV1().Pods(opts.Namespace).UpdateEphemeralContainers(context.TODO(), opts.PodName, pod, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Error(fmt.Sprintf("添加调试容器失败, %v", err))
+		return "", errors.New(fmt.Sprintf("添加调试容器失败, %v", err))
+	}
+
+	if err := d.waitRunning(client, opts.Namespace, opts.PodName, name); err != nil {
+		logger.Error(fmt.Sprintf("等待调试容器运行失败, %v", err))
+		return "", errors.New(fmt.Sprintf("等待调试容器运行失败, %v", err))
+	}
+	return name, nil
+}
+
+// waitRunning 等待临时容器进入 Running 状态，容器退出时立即返回错误
+func (d *podDebug) waitRunning(client kubernetes.Interface, namespace, podName, name string) error {
+	var reason string
+	err := wait.PollUntilContextTimeout(context.TODO(), debugPollInterval, d.ReadyTimeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name != name {
+				continue
+			}
+			switch {
+			case status.State.Running != nil:
+				return true, nil
+			case status.State.Terminated != nil:
+				return false, errors.New(fmt.Sprintf("容器已退出, %s", status.State.Terminated.Reason))
+			case status.State.Waiting != nil:
+				reason = status.State.Waiting.Reason
+			}
+		}
+		return false, nil
+	})
+	if wait.Interrupted(err) && reason != "" {
+		return errors.New(fmt.Sprintf("超时, 容器状态为%s", reason))
+	}
+	return err
+}
+
+func containsContainer(containers []corev1.Container, name string) bool {
+	for _, container := range containers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
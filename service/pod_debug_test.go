@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"kubeadm-platform/config"
+)
+
+func TestCreateDebugContainer(t *testing.T) {
+	pod := newTestPod("app-1", "default", time.Hour)
+	pod.Spec.Containers = []corev1.Container{{Name: "app"}}
+	pod.Status.Phase = corev1.PodRunning
+	// 预置调试容器的运行状态，模拟 kubelet 启动容器
+	pod.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{
+		{Name: "debugger", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		{Name: "pulling", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+	}
+	client := fake.NewSimpleClientset(pod)
+	d := &podDebug{ReadyTimeout: 100 * time.Millisecond}
+
+	tests := []struct {
+		name    string
+		opts    DebugOptions
+		wantErr string
+	}{
+		{name: "添加调试容器", opts: DebugOptions{Name: "debugger", TargetContainer: "app"}},
+		{name: "容器名已存在", opts: DebugOptions{Name: "app"}, wantErr: "已存在"},
+		{name: "目标容器不存在", opts: DebugOptions{Name: "debugger-2", TargetContainer: "missing"}, wantErr: "不存在"},
+		{name: "等待超时返回容器状态", opts: DebugOptions{Name: "pulling"}, wantErr: "ImagePullBackOff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Namespace, opts.PodName = "default", "app-1"
+			name, err := d.CreateDebugContainer(client, &opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("CreateDebugContainer() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || name != opts.Name {
+				t.Fatalf("CreateDebugContainer() = %s, %v", name, err)
+			}
+		})
+	}
+
+	got, err := client.CoreV1().Pods("default").Get(context.TODO(), "app-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := got.Spec.EphemeralContainers[0]
+	if container.Name != "debugger" || container.Image != config.DebugImage || container.TargetContainerName != "app" || !container.TTY || !container.Stdin {
+		t.Errorf("添加的调试容器 = %+v", container)
+	}
+}
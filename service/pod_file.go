@@ -0,0 +1,232 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/wonderivan/logger"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"kubeadm-platform/config"
+)
+
+// PodFile 通过 exec 在容器中执行 tar 实现文件的上传和下载，与 kubectl cp 相同，要求容器内有 tar 命令
+var PodFile = podFile{NewExecutor: newSPDYExecutor}
+
+type podFile struct {
+	// 创建远程执行器的工厂方法
+	NewExecutor ExecutorFactory
+}
+
+// 下载的打包格式
+const (
+	ArchiveTar = "tar"
+	ArchiveZip = "zip"
+)
+
+// PodFileOptions 定义容器文件复制的参数
+type PodFileOptions struct {
+	Namespace     string
+	PodName       string
+	ContainerName string
+	// Path 下载时为容器中的文件或目录，上传时为容器中的目标目录，必须为绝对路径
+	Path string
+}
+
+// errDownloadTooLarge 下载内容超出 config.PodFileMaxDownloadBytes
+var errDownloadTooLarge = errors.New(fmt.Sprintf("下载内容超过%d字节", config.PodFileMaxDownloadBytes))
+
+// Validate 校验并补全文件复制参数，容器校验规则与 exec 相同
+func (f *podFile) Validate(client kubernetes.Interface, opts *PodFileOptions) error {
+	if !path.IsAbs(opts.Path) {
+		return errors.New(fmt.Sprintf("路径:%s必须为绝对路径", opts.Path))
+	}
+	opts.Path = path.Clean(opts.Path)
+	containerName, err := resolveContainer(client, opts.Namespace, opts.PodName, opts.ContainerName)
+	if err != nil {
+		return err
+	}
+	opts.ContainerName = containerName
+	return nil
+}
+
+// exec 在容器中执行命令，stderr 的内容附加在错误信息中
+func (f *podFile) exec(ctx context.Context, client kubernetes.Interface, conf *rest.Config, opts *PodFileOptions, command []string, stdin io.Reader, stdout io.Writer) error {
+	executor, err := f.NewExecutor(client, conf, &ExecOptions{
+		Namespace:     opts.Namespace,
+		PodName:       opts.PodName,
+		ContainerName: opts.ContainerName,
+		Command:       command,
+		Stdin:         stdin != nil,
+	})
+	if err != nil {
+		return err
+	}
+	stderr := new(bytes.Buffer)
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(fmt.Sprintf("%v, %s", err, msg))
+		}
+		return err
+	}
+	return nil
+}
+
+// CopyFromPod 将容器中的文件或目录打包后写入 w，format 为 tar 或 zip
+// 打包内容超过 config.PodFileMaxDownloadBytes 时中断并返回错误
+func (f *podFile) CopyFromPod(ctx context.Context, client kubernetes.Interface, conf *rest.Config, opts *PodFileOptions, format string, w io.Writer) error {
+	if format != ArchiveTar && format != ArchiveZip {
+		return errors.New(fmt.Sprintf("不支持的打包格式:%s，可选 tar、zip", format))
+	}
+	// 与 kubectl cp 相同，在父目录下打包，压缩包内以文件或目录名为根
+	dir, base := path.Dir(opts.Path), path.Base(opts.Path)
+	if base == "/" {
+		base = "."
+	}
+	command := []string{"tar", "cf", "-", "-C", dir, base}
+	limited := &limitWriter{limit: config.PodFileMaxDownloadBytes}
+
+	var err error
+	if format == ArchiveTar {
+		limited.w = w
+		err = f.exec(ctx, client, conf, opts, command, nil, limited)
+	} else {
+		// 边读 tar 流边转换为 zip，不在内存中缓存完整内容
+		pr, pw := io.Pipe()
+		limited.w = pw
+		converted := make(chan error, 1)
+		go func() {
+			convertErr := tarToZip(pr, w)
+			if convertErr == nil {
+				// 读完 tar 结尾的填充块，避免阻塞容器端的写入
+				_, _ = io.Copy(io.Discard, pr)
+			}
+			// 转换失败时中断 tar 流
+			_ = pr.CloseWithError(convertErr)
+			converted <- convertErr
+		}()
+		err = f.exec(ctx, client, conf, opts, command, nil, limited)
+		_ = pw.CloseWithError(err)
+		if convertErr := <-converted; err == nil {
+			err = convertErr
+		}
+	}
+	if limited.exceeded {
+		err = errDownloadTooLarge
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("下载容器文件失败, %v", err))
+		return errors.New(fmt.Sprintf("下载容器文件失败, %v", err))
+	}
+	return nil
+}
+
+// CopyToPod 将 r 中的内容以 name 为文件名写入容器的 opts.Path 目录，size 为文件大小
+func (f *podFile) CopyToPod(ctx context.Context, client kubernetes.Interface, conf *rest.Config, opts *PodFileOptions, name string, size int64, r io.Reader) error {
+	name = path.Base(path.Clean("/" + name))
+	if name == "/" || name == "." {
+		return errors.New("上传文件名不能为空")
+	}
+	if size > config.PodFileMaxUploadBytes {
+		return errors.New(fmt.Sprintf("上传文件超过%d字节", config.PodFileMaxUploadBytes))
+	}
+	// 在 stdin 中写入只包含一个文件的 tar 流，由容器内的 tar 解压到目标目录
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    size,
+			ModTime: time.Now(),
+		})
+		if err == nil {
+			_, err = io.CopyN(tw, r, size)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	err := f.exec(ctx, client, conf, opts, []string{"tar", "xmf", "-", "-C", opts.Path}, pr, io.Discard)
+	_ = pr.Close()
+	if err != nil {
+		logger.Error(fmt.Sprintf("上传文件到容器失败, %v", err))
+		return errors.New(fmt.Sprintf("上传文件到容器失败, %v", err))
+	}
+	return nil
+}
+
+// tarToZip 将 tar 流转换为 zip 写入 w，只保留目录和普通文件
+func tarToZip(r io.Reader, w io.Writer) error {
+	tr := tar.NewReader(r)
+	zw := zip.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+			continue
+		}
+		header, err := zip.FileInfoHeader(hdr.FileInfo())
+		if err != nil {
+			return err
+		}
+		header.Name = strings.TrimPrefix(hdr.Name, "./")
+		if header.Name == "" {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			header.Name = strings.TrimSuffix(header.Name, "/") + "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(fw, tr); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// limitWriter 写入超过 limit 字节时返回错误，用于限制下载大小
+type limitWriter struct {
+	w        io.Writer
+	limit    int64
+	written  int64
+	exceeded bool
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.written+int64(len(p)) > l.limit {
+		l.exceeded = true
+		return 0, errDownloadTooLarge
+	}
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// newTestTar 构造包含一个目录和若干文件的 tar 包
+func newTestTar(t *testing.T, dir string, files map[string]string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: dir + "/" + name, Mode: 0o644, Size: int64(len(content)), ModTime: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// recordingExecutor 记录执行的命令，并以 f 模拟执行
+func recordingExecutor(commands *[][]string, f fakeExecutor) ExecutorFactory {
+	return func(client kubernetes.Interface, conf *rest.Config, opts *ExecOptions) (remotecommand.Executor, error) {
+		*commands = append(*commands, opts.Command)
+		return f, nil
+	}
+}
+
+func TestPodFileValidate(t *testing.T) {
+	pod := newTestPod("app-1", "default", time.Hour)
+	pod.Spec.Containers = []corev1.Container{{Name: "app"}}
+	pod.Status.Phase = corev1.PodRunning
+	client := fake.NewSimpleClientset(pod)
+	defer Cache.Evict(client)
+
+	opts := &PodFileOptions{Namespace: "default", PodName: "app-1", Path: "/var/log/../log/app/"}
+	if err := PodFile.Validate(client, opts); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if opts.Path != "/var/log/app" || opts.ContainerName != "app" {
+		t.Errorf("Validate() = %+v", opts)
+	}
+	if err := PodFile.Validate(client, &PodFileOptions{Namespace: "default", PodName: "app-1", Path: "var/log"}); err == nil {
+		t.Errorf("Validate() 相对路径应返回错误")
+	}
+}
+
+func TestCopyFromPod(t *testing.T) {
+	archive := newTestTar(t, "app", map[string]string{"app.log": "hello", "gc.log": "gc"})
+	var commands [][]string
+	f := &podFile{NewExecutor: recordingExecutor(&commands, func(ctx context.Context, options remotecommand.StreamOptions) error {
+		_, err := options.Stdout.Write(archive)
+		return err
+	})}
+	opts := &PodFileOptions{Namespace: "default", PodName: "app-1", ContainerName: "app", Path: "/var/log/app"}
+
+	// tar 原样返回
+	buf := new(bytes.Buffer)
+	if err := f.CopyFromPod(context.Background(), nil, nil, opts, ArchiveTar, buf); err != nil {
+		t.Fatalf("CopyFromPod(tar) error = %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), archive) {
+		t.Errorf("CopyFromPod(tar) 内容与容器输出不一致")
+	}
+	if got := strings.Join(commands[0], " "); got != "tar cf - -C /var/log app" {
+		t.Errorf("执行的命令 = %s", got)
+	}
+
+	// zip 转换后保留目录和文件
+	buf.Reset()
+	if err := f.CopyFromPod(context.Background(), nil, nil, opts, ArchiveZip, buf); err != nil {
+		t.Fatalf("CopyFromPod(zip) error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, file := range zr.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		got[file.Name] = string(content)
+	}
+	if len(got) != 3 || got["app/app.log"] != "hello" || got["app/gc.log"] != "gc" {
+		t.Errorf("zip 内容 = %v", got)
+	}
+
+	if err := f.CopyFromPod(context.Background(), nil, nil, opts, "rar", buf); err == nil {
+		t.Errorf("CopyFromPod() 不支持的格式应返回错误")
+	}
+
+	// 容器内执行失败时返回 stderr 内容
+	failed := &podFile{NewExecutor: executorFactory(func(ctx context.Context, options remotecommand.StreamOptions) error {
+		_, _ = options.Stderr.Write([]byte("tar: app: No such file or directory\n"))
+		return errors.New("command terminated with exit code 2")
+	})}
+	err = failed.CopyFromPod(context.Background(), nil, nil, opts, ArchiveTar, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "No such file or directory") {
+		t.Errorf("CopyFromPod() error = %v", err)
+	}
+}
+
+func TestLimitWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := &limitWriter{w: buf, limit: 5}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := w.Write([]byte("!")); !errors.Is(err, errDownloadTooLarge) || !w.exceeded {
+		t.Errorf("超出上限时 Write() error = %v", err)
+	}
+	if buf.String() != "hello" {
+		t.Errorf("写入的内容 = %q", buf.String())
+	}
+}
+
+func TestCopyToPod(t *testing.T) {
+	var commands [][]string
+	var name, content string
+	f := &podFile{NewExecutor: recordingExecutor(&commands, func(ctx context.Context, options remotecommand.StreamOptions) error {
+		tr := tar.NewReader(options.Stdin)
+		hdr, err := tr.Next()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(tr)
+		name, content = hdr.Name, string(data)
+		return err
+	})}
+	opts := &PodFileOptions{Namespace: "default", PodName: "app-1", ContainerName: "app", Path: "/etc/app"}
+	if err := f.CopyToPod(context.Background(), nil, nil, opts, "../../config.yaml", 9, strings.NewReader("key: val\n")); err != nil {
+		t.Fatalf("CopyToPod() error = %v", err)
+	}
+	// 文件名中的路径被去掉，只能写入目标目录
+	if name != "config.yaml" || content != "key: val\n" {
+		t.Errorf("上传的文件 = %s, %q", name, content)
+	}
+	if got := strings.Join(commands[0], " "); got != "tar xmf - -C /etc/app" {
+		t.Errorf("执行的命令 = %s", got)
+	}
+	if err := f.CopyToPod(context.Background(), nil, nil, opts, "", 0, strings.NewReader("")); err == nil {
+		t.Errorf("CopyToPod() 文件名为空时应返回错误")
+	}
+}
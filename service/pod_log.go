@@ -0,0 +1,323 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wonderivan/logger"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"kubeadm-platform/config"
+)
+
+// PodLogQuery 定义容器日志的查询条件，对应 corev1.PodLogOptions
+type PodLogQuery struct {
+	ContainerName string
+	// Previous 为 true 时获取上一次退出（如 crash）的容器日志
+	Previous bool
+	// SinceSeconds 和 SinceTime 只能指定一个，SinceTime 为 RFC3339 格式
+	SinceSeconds int64
+	SinceTime    string
+	// TailLines 为 0 时使用默认行数，为 -1 时不限制行数
+	TailLines int64
+	// Timestamps 为 true 时每行日志前加上时间戳
+	Timestamps bool
+	// LimitBytes 从 apiserver 读取的最大字节数，与 kubectl logs --limit-bytes 一致，只返回日志开头的部分
+	LimitBytes int64
+}
+
+// logOptions 校验查询条件并转换为 PodLogOptions，defaultTail 为未指定 TailLines 时的行数，为 0 时不限制
+func (q *PodLogQuery) logOptions(defaultTail int64) (*corev1.PodLogOptions, error) {
+	if q == nil {
+		q = &PodLogQuery{}
+	}
+	if q.SinceSeconds < 0 || q.LimitBytes < 0 || q.TailLines < -1 {
+		return nil, errors.New("since_seconds、limit_bytes、tail_lines 不能为负数")
+	}
+	option := &corev1.PodLogOptions{
+		Container:  q.ContainerName,
+		Previous:   q.Previous,
+		Timestamps: q.Timestamps,
+	}
+	if q.SinceSeconds > 0 && q.SinceTime != "" {
+		return nil, errors.New("since_seconds 和 since_time 只能指定一个")
+	}
+	if q.SinceSeconds > 0 {
+		option.SinceSeconds = &q.SinceSeconds
+	}
+	if q.SinceTime != "" {
+		sinceTime, err := time.Parse(time.RFC3339, q.SinceTime)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("since_time 格式错误，应为 RFC3339, %v", err))
+		}
+		option.SinceTime = &metav1.Time{Time: sinceTime}
+	}
+	switch {
+	case q.TailLines > 0:
+		option.TailLines = &q.TailLines
+	case q.TailLines == 0 && defaultTail > 0:
+		option.TailLines = &defaultTail
+	}
+	if q.LimitBytes > 0 {
+		option.LimitBytes = &q.LimitBytes
+	}
+	return option, nil
+}
+
+// readLogTail 读取日志流，只返回最后不超过 limit 字节的完整行，truncated 表示丢弃了前面的日志
+// 最后一行超过 limit 字节时返回该行的末尾，起点对齐到 UTF-8 字符边界
+func readLogTail(r io.Reader, limit int) (log []byte, truncated bool, err error) {
+	// 多保留一个字节，用于判断窗口的起点是否恰好是行首
+	keep := limit + 1
+	buf := make([]byte, 0, 32<<10)
+	chunk := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		// 超过两倍窗口时丢弃前面的数据，避免每次读取都移动内存
+		if len(buf) > 2*keep {
+			buf = append(buf[:0], buf[len(buf)-keep:]...)
+			truncated = true
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if len(buf) <= limit {
+		return buf, truncated, nil
+	}
+	buf = buf[len(buf)-keep:]
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		return buf[i+1:], true, nil
+	}
+	buf = buf[1:]
+	for len(buf) > 0 && !utf8.RuneStart(buf[0]) {
+		buf = buf[1:]
+	}
+	return buf, true, nil
+}
+
+// countingReader 记录已读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openPodLog 打开容器日志流，调用方需关闭返回的流
+func (p *pod) openPodLog(ctx context.Context, client kubernetes.Interface, podName, namespace string, query *PodLogQuery, defaultTail int64, follow bool) (io.ReadCloser, error) {
+	option, err := query.logOptions(defaultTail)
+	if err != nil {
+		logger.Error(fmt.Sprintf("获取PodLog失败, %v\n", err))
+		return nil, errors.New(fmt.Sprintf("获取PodLog失败, %v\n", err))
+	}
+	option.Follow = follow
+	stream, err := client.CoreV1().Pods(namespace).GetLogs(podName, option).Stream(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("获取PodLog失败, %v\n", err))
+		return nil, errors.New(fmt.Sprintf("获取PodLog失败, %v\n", err))
+	}
+	return stream, nil
+}
+
+// FollowPodLog 以 follow 模式打开容器日志流，ctx 取消时上游连接随之关闭，调用方需关闭返回的流
+// 未指定 TailLines 时使用 config.PodLogFollowTailLine
+func (p *pod) FollowPodLog(ctx context.Context, client kubernetes.Interface, podName, namespace string, query *PodLogQuery) (io.ReadCloser, error) {
+	return p.openPodLog(ctx, client, podName, namespace, query, config.PodLogFollowTailLine, true)
+}
+
+// DownloadPodLog 打开容器日志流用于下载，未指定 TailLines 时返回全部日志，调用方需关闭返回的流
+func (p *pod) DownloadPodLog(ctx context.Context, client kubernetes.Interface, podName, namespace string, query *PodLogQuery) (io.ReadCloser, error) {
+	return p.openPodLog(ctx, client, podName, namespace, query, 0, false)
+}
+
+// WriteLogGzip 将日志流以 gzip 压缩写入 w，不在内存中缓存完整日志
+func (p *pod) WriteLogGzip(w io.Writer, stream io.Reader) error {
+	gw := gzip.NewWriter(w)
+	if _, err := io.Copy(gw, stream); err != nil {
+		logger.Error(fmt.Sprintf("压缩PodLog失败, %v\n", err))
+		return errors.New(fmt.Sprintf("压缩PodLog失败, %v\n", err))
+	}
+	return gw.Close()
+}
+
+// LogSearch 定义日志搜索条件，类似 grep
+type LogSearch struct {
+	// Pattern 为空时不搜索
+	Pattern string
+	// Regex 为 true 时 Pattern 按正则表达式匹配，否则按子串匹配
+	Regex      bool
+	IgnoreCase bool
+	// Context 匹配行前后各返回的行数，类似 grep -C
+	Context int
+}
+
+// LogSearchLine 搜索结果中的一行
+type LogSearchLine struct {
+	// Number 在返回的日志范围内的行号，从 1 开始，不连续处表示中间有省略
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+	// Match 为 false 表示该行是上下文
+	Match bool `json:"match"`
+}
+
+// LogSearchResp 定义日志搜索的返回类型
+type LogSearchResp struct {
+	Lines []LogSearchLine `json:"lines"`
+	// Matches 匹配的行数
+	Matches int `json:"matches"`
+	// Truncated 结果超过 config.PodLogMaxBytes 后停止搜索
+	Truncated bool `json:"truncated"`
+}
+
+// errSearchTruncated 搜索结果达到上限时用于停止读取日志流
+var errSearchTruncated = errors.New("搜索结果超出上限")
+
+// matcher 校验搜索条件并返回匹配函数
+func (s *LogSearch) matcher() (func(line string) bool, error) {
+	if s.Context < 0 || s.Context > config.PodLogSearchMaxContext {
+		return nil, errors.New(fmt.Sprintf("context 应在 0 到 %d 之间", config.PodLogSearchMaxContext))
+	}
+	if s.Regex {
+		pattern := s.Pattern
+		if s.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("正则表达式不合法, %v", err))
+		}
+		return re.MatchString, nil
+	}
+	if s.IgnoreCase {
+		pattern := strings.ToLower(s.Pattern)
+		return func(line string) bool { return strings.Contains(strings.ToLower(line), pattern) }, nil
+	}
+	return func(line string) bool { return strings.Contains(line, s.Pattern) }, nil
+}
+
+// SearchPodLog 在容器日志中搜索，边读边匹配，只返回匹配行及其上下文
+// 日志范围与 GetPodLog 相同，未指定 TailLines 时搜索最后 config.PodLogTailLine 行，tail_lines=-1 时搜索全部日志
+func (p *pod) SearchPodLog(client kubernetes.Interface, podName, namespace string, query *PodLogQuery, search *LogSearch) (*LogSearchResp, error) {
+	match, err := search.matcher()
+	if err != nil {
+		logger.Error(fmt.Sprintf("搜索PodLog失败, %v\n", err))
+		return nil, errors.New(fmt.Sprintf("搜索PodLog失败, %v\n", err))
+	}
+	stream, err := p.openPodLog(context.TODO(), client, podName, namespace, query, config.PodLogTailLine, false)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	return p.searchLines(stream, match, search.Context)
+}
+
+// searchLines 逐行匹配日志流，保留匹配行前后 contextLines 行
+func (p *pod) searchLines(stream io.ReadCloser, match func(line string) bool, contextLines int) (*LogSearchResp, error) {
+	resp := &LogSearchResp{Lines: []LogSearchLine{}}
+	// before 保存最近的 contextLines 行，afterLeft 为匹配行之后还需返回的行数
+	before := make([]LogSearchLine, 0, contextLines)
+	afterLeft, number, size := 0, 0, 0
+	emit := func(line LogSearchLine) error {
+		size += len(line.Text)
+		if size > config.PodLogMaxBytes {
+			resp.Truncated = true
+			return errSearchTruncated
+		}
+		resp.Lines = append(resp.Lines, line)
+		return nil
+	}
+	err := p.StreamLogLines(context.TODO(), stream, func(text string) error {
+		number++
+		line := LogSearchLine{Number: number, Text: text}
+		switch {
+		case match(text):
+			for _, b := range before {
+				if err := emit(b); err != nil {
+					return err
+				}
+			}
+			before = before[:0]
+			line.Match = true
+			resp.Matches++
+			afterLeft = contextLines
+			return emit(line)
+		case afterLeft > 0:
+			afterLeft--
+			return emit(line)
+		case contextLines > 0:
+			if len(before) == contextLines {
+				before = append(before[:0], before[1:]...)
+			}
+			before = append(before, line)
+		}
+		return nil
+	})
+	if err != nil && err != errSearchTruncated {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// StreamLogLines 逐行读取日志流并调用 send，直到日志流结束、send 返回错误或 ctx 取消
+// 超过 config.PodLogMaxLineBytes 的行只推送开头部分，日志流正常结束（如容器退出）时返回 nil
+func (p *pod) StreamLogLines(ctx context.Context, stream io.ReadCloser, send func(line string) error) error {
+	// 阻塞在 Read 上时无法感知 ctx，取消时主动关闭日志流
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = stream.Close()
+		case <-done:
+		}
+	}()
+
+	// 缓冲区大小即单行上限，超长的行只保留开头部分
+	reader := bufio.NewReaderSize(stream, config.PodLogMaxLineBytes)
+	for {
+		line, isPrefix, err := reader.ReadLine()
+		if err == nil {
+			text := string(line)
+			if isPrefix {
+				// 截断处对齐到 UTF-8 字符边界，并丢弃该行剩余的部分
+				text = string(line[:len(line)-incompleteRuneLen(line)])
+				for isPrefix && err == nil {
+					_, isPrefix, err = reader.ReadLine()
+				}
+			}
+			if sendErr := send(text); sendErr != nil {
+				return sendErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error(fmt.Sprintf("读取PodLog失败, %v\n", err))
+			return errors.New(fmt.Sprintf("读取PodLog失败, %v\n", err))
+		}
+	}
+}
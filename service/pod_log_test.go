@@ -0,0 +1,269 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"kubeadm-platform/config"
+)
+
+func TestPodLogOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    *PodLogQuery
+		wantTail int64
+		wantErr  bool
+	}{
+		{name: "未指定 tail_lines 时使用默认行数", query: &PodLogQuery{}, wantTail: config.PodLogTailLine},
+		{name: "tail_lines 为 -1 时不限制行数", query: &PodLogQuery{TailLines: -1}, wantTail: -1},
+		{name: "指定 since_time 和 previous", query: &PodLogQuery{TailLines: 10, SinceTime: "2023-05-01T08:00:00Z", Previous: true}, wantTail: 10},
+		{name: "since_seconds 和 since_time 同时指定", query: &PodLogQuery{SinceSeconds: 60, SinceTime: "2023-05-01T08:00:00Z"}, wantErr: true},
+		{name: "since_time 格式错误", query: &PodLogQuery{SinceTime: "2023-05-01 08:00:00"}, wantErr: true},
+		{name: "limit_bytes 为负数", query: &PodLogQuery{LimitBytes: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			option, err := tt.query.logOptions(config.PodLogTailLine)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("logOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			gotTail := int64(-1)
+			if option.TailLines != nil {
+				gotTail = *option.TailLines
+			}
+			if gotTail != tt.wantTail {
+				t.Errorf("logOptions() tailLines = %d, want %d", gotTail, tt.wantTail)
+			}
+			if option.Previous != tt.query.Previous || (tt.query.SinceTime != "") != (option.SinceTime != nil) {
+				t.Errorf("logOptions() = %+v", option)
+			}
+		})
+	}
+}
+
+func TestGetPodLog(t *testing.T) {
+	// fake clientset 固定返回 fake logs
+	client := fake.NewSimpleClientset(newTestPod("nginx-1", "default", time.Hour))
+	log, truncated, err := Pod.GetPodLog(client, "nginx-1", "default", &PodLogQuery{ContainerName: "nginx"})
+	if err != nil || log != "fake logs" || truncated {
+		t.Errorf("GetPodLog() = %q, %v, %v", log, truncated, err)
+	}
+	// limit_bytes 与其他日志接口一致，返回日志开头的部分
+	log, truncated, err = Pod.GetPodLog(client, "nginx-1", "default", &PodLogQuery{ContainerName: "nginx", LimitBytes: 4})
+	if err != nil || log != "fake" || truncated {
+		t.Errorf("GetPodLog() = %q, %v, %v", log, truncated, err)
+	}
+}
+
+func TestReadLogTail(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		limit         int
+		wantLog       string
+		wantTruncated bool
+	}{
+		{name: "未超出上限", content: "line1\nline2\n", limit: 20, wantLog: "line1\nline2\n"},
+		{name: "恰好等于上限", content: "line1\nline2\n", limit: 12, wantLog: "line1\nline2\n"},
+		{name: "丢弃不完整的第一行", content: "line1\nline2\nline3\n", limit: 10, wantLog: "line3\n", wantTruncated: true},
+		{name: "窗口起点恰好是行首", content: "line1\nline2\nline3\n", limit: 12, wantLog: "line2\nline3\n", wantTruncated: true},
+		{name: "最后一行超过上限", content: "line1\n日志日志", limit: 4, wantLog: "志", wantTruncated: true},
+		{name: "超过两倍上限", content: strings.Repeat("0123456789\n", 100) + "last\n", limit: 16, wantLog: "0123456789\nlast\n", wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 每次只读取一个字节，覆盖分块读取时丢弃前面数据的逻辑
+			log, truncated, err := readLogTail(iotest.OneByteReader(strings.NewReader(tt.content)), tt.limit)
+			if err != nil || string(log) != tt.wantLog || truncated != tt.wantTruncated {
+				t.Errorf("readLogTail() = %q, %v, %v, want %q, %v", log, truncated, err, tt.wantLog, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestStreamLogLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		sendErr   error
+		wantLines []string
+		wantErr   bool
+	}{
+		{
+			name:      "逐行推送，最后一行没有换行符",
+			content:   "line-1\r\nline-2\nline-3",
+			wantLines: []string{"line-1", "line-2", "line-3"},
+		},
+		{
+			name:      "超长的行只保留开头部分",
+			content:   "line-1\n" + strings.Repeat("a", config.PodLogMaxLineBytes-1) + "中" + strings.Repeat("b", 100) + "\nline-3\n",
+			wantLines: []string{"line-1", strings.Repeat("a", config.PodLogMaxLineBytes-1), "line-3"},
+		},
+		{
+			name:      "空行",
+			content:   "line-1\n\nline-3\n",
+			wantLines: []string{"line-1", "", "line-3"},
+		},
+		{
+			name:      "send 失败时停止推送",
+			content:   "line-1\nline-2\n",
+			sendErr:   errors.New("broken pipe"),
+			wantLines: []string{"line-1"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []string
+			err := Pod.StreamLogLines(context.Background(), io.NopCloser(strings.NewReader(tt.content)), func(line string) error {
+				lines = append(lines, line)
+				return tt.sendErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("StreamLogLines() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(lines, ",") != strings.Join(tt.wantLines, ",") {
+				t.Errorf("StreamLogLines() lines = %v, want %v", lines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestStreamLogLinesCancel(t *testing.T) {
+	// 上游日志流一直没有结束，客户端断开后应关闭日志流并返回
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- Pod.StreamLogLines(ctx, reader, func(line string) error {
+			received <- line
+			return nil
+		})
+	}()
+
+	if _, err := writer.Write([]byte("started\n")); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-received; line != "started" {
+		t.Errorf("收到的日志 = %q, want started", line)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("StreamLogLines() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消后日志流未关闭")
+	}
+}
+
+func TestFollowPodLog(t *testing.T) {
+	client := fake.NewSimpleClientset(newTestPod("nginx-1", "default", time.Hour))
+	stream, err := Pod.FollowPodLog(context.Background(), client, "nginx-1", "default", &PodLogQuery{ContainerName: "nginx"})
+	if err != nil {
+		t.Fatalf("FollowPodLog() error = %v", err)
+	}
+	defer stream.Close()
+	var lines []string
+	if err := Pod.StreamLogLines(context.Background(), stream, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}); err != nil {
+		t.Fatalf("StreamLogLines() error = %v", err)
+	}
+	// fake clientset 固定返回 fake logs
+	if len(lines) != 1 || lines[0] != "fake logs" {
+		t.Errorf("lines = %v", lines)
+	}
+}
+
+func TestSearchLines(t *testing.T) {
+	content := strings.Join([]string{
+		"starting server",         // 1
+		"GET /health 200",         // 2
+		"ERROR db timeout",        // 3
+		"retrying",                // 4
+		"GET /health 200",         // 5
+		"GET /health 200",         // 6
+		"GET /health 200",         // 7
+		"error: connection reset", // 8
+		"shutdown",                // 9
+	}, "\n")
+
+	tests := []struct {
+		name        string
+		search      *LogSearch
+		wantNumbers []int
+		wantMatches int
+		wantErr     bool
+	}{
+		{name: "子串匹配区分大小写", search: &LogSearch{Pattern: "ERROR"}, wantNumbers: []int{3}, wantMatches: 1},
+		{name: "忽略大小写", search: &LogSearch{Pattern: "error", IgnoreCase: true}, wantNumbers: []int{3, 8}, wantMatches: 2},
+		{name: "正则匹配并返回上下文", search: &LogSearch{Pattern: `(?i)^error`, Regex: true, Context: 1}, wantNumbers: []int{2, 3, 4, 7, 8, 9}, wantMatches: 2},
+		{name: "上下文重叠时不重复返回", search: &LogSearch{Pattern: "retrying|shutdown", Regex: true, Context: 5}, wantNumbers: []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, wantMatches: 2},
+		{name: "正则不合法", search: &LogSearch{Pattern: "(", Regex: true}, wantErr: true},
+		{name: "context 超出上限", search: &LogSearch{Pattern: "x", Context: config.PodLogSearchMaxContext + 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := tt.search.matcher()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("matcher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			resp, err := Pod.searchLines(io.NopCloser(strings.NewReader(content)), match, tt.search.Context)
+			if err != nil {
+				t.Fatalf("searchLines() error = %v", err)
+			}
+			var numbers []int
+			for _, line := range resp.Lines {
+				numbers = append(numbers, line.Number)
+			}
+			if fmt.Sprint(numbers) != fmt.Sprint(tt.wantNumbers) || resp.Matches != tt.wantMatches {
+				t.Errorf("searchLines() lines = %v, matches = %d, want %v, %d", numbers, resp.Matches, tt.wantNumbers, tt.wantMatches)
+			}
+		})
+	}
+}
+
+func TestDownloadPodLog(t *testing.T) {
+	client := fake.NewSimpleClientset(newTestPod("nginx-1", "default", time.Hour))
+	stream, err := Pod.DownloadPodLog(context.Background(), client, "nginx-1", "default", &PodLogQuery{ContainerName: "nginx"})
+	if err != nil {
+		t.Fatalf("DownloadPodLog() error = %v", err)
+	}
+	defer stream.Close()
+	var buf bytes.Buffer
+	if err := Pod.WriteLogGzip(&buf, stream); err != nil {
+		t.Fatalf("WriteLogGzip() error = %v", err)
+	}
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(gr)
+	if err != nil || string(content) != "fake logs" {
+		t.Errorf("解压后的日志 = %q, %v", content, err)
+	}
+}
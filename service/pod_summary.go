@@ -0,0 +1,152 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// PodSummary 列表使用的 pod 摘要，字段与 kubectl get pods -o wide 一致，完整对象通过详情接口获取
+type PodSummary struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Status 与 kubectl 显示的 STATUS 一致，如 Running、CrashLoopBackOff、Init:0/1、Terminating
+	Status string          `json:"status"`
+	Phase  corev1.PodPhase `json:"phase"`
+	// Ready 就绪容器数/容器总数，如 1/2
+	Ready    string `json:"ready"`
+	Restarts int32  `json:"restarts"`
+	// LastRestartAt 最近一次重启的时间，没有重启时为空
+	LastRestartAt *metav1.Time `json:"last_restart_at,omitempty"`
+	// Age 创建至今的时长，如 5d3h
+	Age               string      `json:"age"`
+	CreationTimestamp metav1.Time `json:"creation_timestamp"`
+	NodeName          string      `json:"node_name"`
+	PodIP             string      `json:"pod_ip"`
+	// OwnerKind、OwnerName 控制该 pod 的资源，如 ReplicaSet
+	OwnerKind string   `json:"owner_kind,omitempty"`
+	OwnerName string   `json:"owner_name,omitempty"`
+	Images    []string `json:"images"`
+}
+
+// toPodSummaries 将 pod 列表转换为摘要
+func toPodSummaries(pods []corev1.Pod) []PodSummary {
+	summaries := make([]PodSummary, len(pods))
+	now := time.Now()
+	for i := range pods {
+		summaries[i] = newPodSummary(&pods[i], now)
+	}
+	return summaries
+}
+
+func newPodSummary(pod *corev1.Pod, now time.Time) PodSummary {
+	status, ready, restarts, lastRestart := podStatus(pod)
+	summary := PodSummary{
+		Name:              pod.Name,
+		Namespace:         pod.Namespace,
+		Labels:            pod.Labels,
+		Status:            status,
+		Phase:             pod.Status.Phase,
+		Ready:             fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers)),
+		Restarts:          restarts,
+		LastRestartAt:     lastRestart,
+		Age:               duration.HumanDuration(now.Sub(pod.CreationTimestamp.Time)),
+		CreationTimestamp: pod.CreationTimestamp,
+		NodeName:          pod.Spec.NodeName,
+		PodIP:             pod.Status.PodIP,
+		Images:            containerImages(&pod.Spec),
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		summary.OwnerKind, summary.OwnerName = owner.Kind, owner.Name
+	}
+	return summary
+}
+
+// podStatus 按 kubectl 的规则计算 pod 显示的状态、就绪容器数和重启次数
+// init 容器未完成时状态为 Init:<原因> 或 Init:<已完成>/<总数>，重启次数为 init 容器的重启次数
+func podStatus(pod *corev1.Pod) (status string, ready int, restarts int32, lastRestart *metav1.Time) {
+	status = string(pod.Status.Phase)
+	if pod.Status.Reason != "" {
+		status = pod.Status.Reason
+	}
+	// 记录最近一次重启，即上一次退出的时间
+	trackRestart := func(container corev1.ContainerStatus) {
+		restarts += container.RestartCount
+		if terminated := container.LastTerminationState.Terminated; terminated != nil {
+			if lastRestart == nil || lastRestart.Before(&terminated.FinishedAt) {
+				finishedAt := terminated.FinishedAt
+				lastRestart = &finishedAt
+			}
+		}
+	}
+
+	initializing := false
+	for i, container := range pod.Status.InitContainerStatuses {
+		trackRestart(container)
+		switch {
+		case container.State.Terminated != nil && container.State.Terminated.ExitCode == 0:
+			continue
+		case container.State.Terminated != nil:
+			status = "Init:" + terminatedReason(container.State.Terminated)
+		case container.State.Waiting != nil && container.State.Waiting.Reason != "" && container.State.Waiting.Reason != "PodInitializing":
+			status = "Init:" + container.State.Waiting.Reason
+		default:
+			status = fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers))
+		}
+		initializing = true
+		break
+	}
+
+	if !initializing {
+		restarts, lastRestart = 0, nil
+		hasRunning := false
+		// 与 kubectl 相同，倒序遍历使第一个异常容器的原因生效
+		for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			container := pod.Status.ContainerStatuses[i]
+			trackRestart(container)
+			switch {
+			case container.State.Waiting != nil && container.State.Waiting.Reason != "":
+				status = container.State.Waiting.Reason
+			case container.State.Terminated != nil:
+				status = terminatedReason(container.State.Terminated)
+			case container.Ready && container.State.Running != nil:
+				hasRunning = true
+				ready++
+			}
+		}
+		// 部分容器已正常退出而其他容器仍在运行
+		if status == "Completed" && hasRunning {
+			status = "NotReady"
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+					status = string(corev1.PodRunning)
+				}
+			}
+		}
+	}
+
+	if pod.DeletionTimestamp != nil {
+		if pod.Status.Reason == "NodeLost" {
+			status = "Unknown"
+		} else {
+			status = "Terminating"
+		}
+	}
+	return status, ready, restarts, lastRestart
+}
+
+// terminatedReason 容器退出的原因，没有原因时显示信号或退出码
+func terminatedReason(terminated *corev1.ContainerStateTerminated) string {
+	switch {
+	case terminated.Reason != "":
+		return terminated.Reason
+	case terminated.Signal != 0:
+		return fmt.Sprintf("Signal:%d", terminated.Signal)
+	default:
+		return fmt.Sprintf("ExitCode:%d", terminated.ExitCode)
+	}
+}
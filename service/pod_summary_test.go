@@ -0,0 +1,117 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodStatus(t *testing.T) {
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	waiting := func(reason string) corev1.ContainerState {
+		return corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}}
+	}
+	terminated := func(reason string, exitCode int32) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode}}
+	}
+	newPod := func(phase corev1.PodPhase, initStatuses, statuses []corev1.ContainerStatus) *corev1.Pod {
+		pod := newTestPod("app-1", "default", time.Hour)
+		pod.Status.Phase = phase
+		for range initStatuses {
+			pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{})
+		}
+		for range statuses {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{})
+		}
+		pod.Status.InitContainerStatuses = initStatuses
+		pod.Status.ContainerStatuses = statuses
+		return pod
+	}
+	terminating := newPod(corev1.PodRunning, nil, []corev1.ContainerStatus{{State: running, Ready: true}})
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	tests := []struct {
+		name         string
+		pod          *corev1.Pod
+		wantStatus   string
+		wantReady    int
+		wantRestarts int32
+	}{
+		{
+			name:       "正常运行",
+			pod:        newPod(corev1.PodRunning, nil, []corev1.ContainerStatus{{State: running, Ready: true}, {State: running, Ready: true}}),
+			wantStatus: "Running", wantReady: 2,
+		},
+		{
+			name:       "容器反复崩溃",
+			pod:        newPod(corev1.PodRunning, nil, []corev1.ContainerStatus{{State: running, Ready: true}, {State: waiting("CrashLoopBackOff"), RestartCount: 5}}),
+			wantStatus: "CrashLoopBackOff", wantReady: 1, wantRestarts: 5,
+		},
+		{
+			name:       "容器退出没有原因时显示退出码",
+			pod:        newPod(corev1.PodFailed, nil, []corev1.ContainerStatus{{State: terminated("", 137)}}),
+			wantStatus: "ExitCode:137",
+		},
+		{
+			name:       "init 容器运行中",
+			pod:        newPod(corev1.PodPending, []corev1.ContainerStatus{{State: terminated("Completed", 0)}, {State: running}}, []corev1.ContainerStatus{{State: waiting("PodInitializing")}}),
+			wantStatus: "Init:1/2",
+		},
+		{
+			name:       "init 容器失败",
+			pod:        newPod(corev1.PodPending, []corev1.ContainerStatus{{State: waiting("CrashLoopBackOff"), RestartCount: 3}}, []corev1.ContainerStatus{{State: waiting("PodInitializing")}}),
+			wantStatus: "Init:CrashLoopBackOff", wantRestarts: 3,
+		},
+		{
+			name:       "部分容器已完成",
+			pod:        newPod(corev1.PodRunning, nil, []corev1.ContainerStatus{{State: running, Ready: true}, {State: terminated("Completed", 0)}}),
+			wantStatus: "NotReady", wantReady: 1,
+		},
+		{
+			name:       "删除中",
+			pod:        terminating,
+			wantStatus: "Terminating", wantReady: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, ready, restarts, _ := podStatus(tt.pod)
+			if status != tt.wantStatus || ready != tt.wantReady || restarts != tt.wantRestarts {
+				t.Errorf("podStatus() = %s, %d, %d, want %s, %d, %d", status, ready, restarts, tt.wantStatus, tt.wantReady, tt.wantRestarts)
+			}
+		})
+	}
+}
+
+func TestNewPodSummary(t *testing.T) {
+	pod := newTestPod("web-1", "default", 5*24*time.Hour)
+	isController := true
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d8f", Controller: &isController}}
+	pod.Spec.NodeName = "node-1"
+	pod.Spec.Containers = []corev1.Container{{Name: "web", Image: "nginx:1.25"}}
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.PodIP = "10.0.0.1"
+	finishedAt := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Ready:                true,
+		RestartCount:         1,
+		State:                corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{FinishedAt: finishedAt}},
+	}}
+
+	summary := newPodSummary(pod, time.Now())
+	if summary.Status != "Running" || summary.Ready != "1/1" || summary.Restarts != 1 || summary.Age != "5d" {
+		t.Errorf("newPodSummary() = %+v", summary)
+	}
+	if summary.OwnerKind != "ReplicaSet" || summary.OwnerName != "web-5d8f" || summary.NodeName != "node-1" || summary.PodIP != "10.0.0.1" {
+		t.Errorf("newPodSummary() = %+v", summary)
+	}
+	if len(summary.Images) != 1 || summary.Images[0] != "nginx:1.25" {
+		t.Errorf("newPodSummary() images = %v", summary.Images)
+	}
+	if summary.LastRestartAt == nil || !summary.LastRestartAt.Equal(&finishedAt) {
+		t.Errorf("newPodSummary() last restart = %v", summary.LastRestartAt)
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestPod 构造测试用 pod，age 为距今的创建时长
+func newTestPod(name, namespace string, age time.Duration) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		},
+	}
+}
+
+func TestGetPods(t *testing.T) {
+	objects := []runtime.Object{
+		newTestPod("nginx-1", "default", 3*time.Hour),
+		newTestPod("nginx-2", "default", 2*time.Hour),
+		newTestPod("redis-1", "default", 1*time.Hour),
+		newTestPod("nginx-3", "kube-system", 30*time.Minute),
+	}
+
+	tests := []struct {
+		name       string
+		filterName string
+		namespace  string
+		limit      int
+		page       int
+		wantNames  []string
+		wantTotal  int
+	}{
+		{
+			name:      "按创建时间倒序返回命名空间下所有 pod",
+			namespace: "default",
+			wantNames: []string{"redis-1", "nginx-2", "nginx-1"},
+			wantTotal: 3,
+		},
+		{
+			name:      "namespace 为空时返回所有命名空间",
+			wantNames: []string{"nginx-3", "redis-1", "nginx-2", "nginx-1"},
+			wantTotal: 4,
+		},
+		{
+			name:       "按名称过滤",
+			filterName: "nginx",
+			namespace:  "default",
+			wantNames:  []string{"nginx-2", "nginx-1"},
+			wantTotal:  2,
+		},
+		{
+			name:      "分页返回第二页，total 为过滤后的总数",
+			namespace: "default",
+			limit:     2,
+			page:      2,
+			wantNames: []string{"nginx-1"},
+			wantTotal: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(objects...)
+			resp, err := Pod.GetPods(client, tt.namespace, &DataSelectorQuery{
+				FilterQuery:   &FilterQuery{Name: tt.filterName},
+				PaginateQuery: &PaginateQuery{Limit: tt.limit, Page: tt.page},
+			}, false)
+			if err != nil {
+				t.Fatalf("GetPods() error = %v", err)
+			}
+			if resp.Total != tt.wantTotal {
+				t.Errorf("GetPods() total = %d, want %d", resp.Total, tt.wantTotal)
+			}
+			if len(resp.Items) != len(tt.wantNames) {
+				t.Fatalf("GetPods() got %d items, want %d", len(resp.Items), len(tt.wantNames))
+			}
+			for i, item := range resp.Items {
+				if item.Name != tt.wantNames[i] {
+					t.Errorf("GetPods() items[%d] = %s, want %s", i, item.Name, tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetPodsByCursor(t *testing.T) {
+	// fake clientset 不支持 limit/continue，由 reactor 模拟 apiserver 返回的一页数据
+	remaining := int64(5)
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &corev1.PodList{
+			ListMeta: metav1.ListMeta{Continue: "next-token", RemainingItemCount: &remaining},
+			Items:    []corev1.Pod{*newTestPod("nginx-1", "default", time.Hour), *newTestPod("redis-1", "default", time.Hour)},
+		}, nil
+	})
+
+	resp, err := Pod.GetPods(client, "default", &DataSelectorQuery{
+		FilterQuery:   &FilterQuery{Name: "nginx"},
+		PaginateQuery: &PaginateQuery{CursorMode: true, Limit: 2},
+	}, true)
+	if err != nil {
+		t.Fatalf("GetPods() error = %v", err)
+	}
+	if resp.Total != 1 || resp.Items[0].Name != "nginx-1" {
+		t.Errorf("GetPods() 名称过滤应在当前页内生效, got %d items", resp.Total)
+	}
+	if resp.Cursor != encodeCursor("next-token") || resp.Remaining == nil || *resp.Remaining != remaining {
+		t.Errorf("GetPods() cursor = %q, remaining = %v", resp.Cursor, resp.Remaining)
+	}
+	if resp.Cache.Source != CacheSourceAPIServer {
+		t.Errorf("游标分页应直接访问 apiserver, source = %s", resp.Cache.Source)
+	}
+
+	// continue token 过期
+	expired := fake.NewSimpleClientset()
+	expired.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewResourceExpired("The provided continue parameter is too old")
+	})
+	_, err = Pod.GetPods(expired, "default", &DataSelectorQuery{
+		PaginateQuery: &PaginateQuery{CursorMode: true, Cursor: encodeCursor("old-token")},
+	}, false)
+	if err == nil || !strings.Contains(err.Error(), "游标已过期") {
+		t.Errorf("GetPods() 游标过期 error = %v", err)
+	}
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wonderivan/logger"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+
+	"kubeadm-platform/config"
+)
+
+// PortForward 管理经由平台转发到 pod 端口的会话
+// 每个会话在本机回环地址上启动一个 client-go 的 port-forward，通过 websocket 隧道或 http 代理访问
+var PortForward = portForward{StartForward: startSPDYForward}
+
+// ForwardStarter 建立到 pod 端口的转发，返回本机可连接的地址，done 在转发结束时返回原因
+// stopCh 关闭时停止转发，返回错误时调用方也会关闭 stopCh，测试时可替换为不依赖 apiserver 的实现
+type ForwardStarter func(client kubernetes.Interface, conf *rest.Config, namespace, podName string, port int, stopCh <-chan struct{}) (localAddr string, done <-chan error, err error)
+
+type portForward struct {
+	// 建立端口转发的工厂方法
+	StartForward ForwardStarter
+
+	mu       sync.Mutex
+	sessions map[string]*forwardSession
+	// 正在建立转发的会话数，与 sessions 一起计入会话数上限
+	pending int
+}
+
+// PortForwardSession 定义端口转发会话
+type PortForwardSession struct {
+	// ID 会话标识，同时作为访问隧道和代理的凭证
+	ID        string    `json:"id"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	PodName   string    `json:"pod_name"`
+	Port      int       `json:"port"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type forwardSession struct {
+	PortForwardSession
+	localAddr string
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	timer     *time.Timer
+}
+
+func (s *forwardSession) stop() {
+	s.stopOnce.Do(func() {
+		s.timer.Stop()
+		close(s.stopCh)
+	})
+}
+
+// startSPDYForward 默认的转发实现，使用 client-go 的 portforward 在 127.0.0.1 的随机端口上监听
+func startSPDYForward(client kubernetes.Interface, conf *rest.Config, namespace, podName string, port int, stopCh <-chan struct{}) (string, <-chan error, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(conf)
+	if err != nil {
+		return "", nil, err
+	}
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+	readyCh := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", port)}, stopCh, readyCh, io.Discard, io.Discard)
+	if err != nil {
+		return "", nil, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- fw.ForwardPorts() }()
+	select {
+	case <-readyCh:
+	case err := <-done:
+		return "", nil, err
+	case <-time.After(config.PortForwardReadyTimeout):
+		// 连接可能在超时后才建立，由调用方关闭 stopCh 结束 ForwardPorts
+		return "", nil, errors.New(fmt.Sprintf("建立端口转发超时(%s)", config.PortForwardReadyTimeout))
+	}
+	ports, err := fw.GetPorts()
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("127.0.0.1:%d", ports[0].Local), done, nil
+}
+
+// newSessionID 生成随机的会话 ID
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Create 创建到 pod 端口的转发会话，ttl 为 0 时使用 config.PortForwardSessionTTL，不能超过 config.PortForwardMaxSessionTTL
+func (p *portForward) Create(client kubernetes.Interface, conf *rest.Config, cluster, namespace, podName string, port int, ttl time.Duration) (*PortForwardSession, error) {
+	if port <= 0 || port > 65535 {
+		return nil, errors.New(fmt.Sprintf("端口:%d不合法", port))
+	}
+	if ttl <= 0 {
+		ttl = config.PortForwardSessionTTL
+	}
+	if ttl > config.PortForwardMaxSessionTTL {
+		return nil, errors.New(fmt.Sprintf("会话有效期不能超过%s", config.PortForwardMaxSessionTTL))
+	}
+	pod, _, err := Pod.GetPodDetail(client, podName, namespace, true)
+	if err != nil {
+		return nil, err
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil, errors.New(fmt.Sprintf("Pod:%s当前状态为%s，无法转发端口", podName, pod.Status.Phase))
+	}
+	// 建立转发前先占用名额，避免并发创建时超过上限
+	p.mu.Lock()
+	if len(p.sessions)+p.pending >= config.PortForwardMaxSessions {
+		p.mu.Unlock()
+		return nil, errors.New(fmt.Sprintf("端口转发会话数已达上限%d", config.PortForwardMaxSessions))
+	}
+	p.pending++
+	p.mu.Unlock()
+	release := func() {
+		p.mu.Lock()
+		p.pending--
+		p.mu.Unlock()
+	}
+	id, err := newSessionID()
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	stopCh := make(chan struct{})
+	localAddr, done, err := p.StartForward(client, conf, namespace, podName, port, stopCh)
+	if err != nil {
+		// 停止可能在超时后才建立的转发
+		close(stopCh)
+		release()
+		logger.Error(fmt.Sprintf("建立端口转发失败, %v", err))
+		return nil, errors.New(fmt.Sprintf("建立端口转发失败, %v", err))
+	}
+	now := time.Now()
+	session := &forwardSession{
+		PortForwardSession: PortForwardSession{
+			ID:        id,
+			Cluster:   cluster,
+			Namespace: namespace,
+			PodName:   podName,
+			Port:      port,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ttl),
+		},
+		localAddr: localAddr,
+		stopCh:    stopCh,
+	}
+	// 到期后关闭转发
+	session.timer = time.AfterFunc(ttl, func() { _ = p.Delete(id) })
+
+	p.mu.Lock()
+	if p.sessions == nil {
+		p.sessions = make(map[string]*forwardSession)
+	}
+	p.sessions[id] = session
+	p.pending--
+	p.mu.Unlock()
+	// 转发异常结束（如 pod 被删除）时移除会话
+	go func() {
+		if err := <-done; err != nil {
+			logger.Warn(fmt.Sprintf("端口转发%s/%s:%d已结束, %v", namespace, podName, port, err))
+		}
+		_ = p.Delete(id)
+	}()
+	return &session.PortForwardSession, nil
+}
+
+// List 返回所有会话，按创建时间排序
+func (p *portForward) List() []PortForwardSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sessions := make([]PortForwardSession, 0, len(p.sessions))
+	for _, session := range p.sessions {
+		sessions = append(sessions, session.PortForwardSession)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.Before(sessions[j].CreatedAt) })
+	return sessions
+}
+
+// Delete 关闭并移除会话
+func (p *portForward) Delete(id string) error {
+	p.mu.Lock()
+	session, ok := p.sessions[id]
+	delete(p.sessions, id)
+	p.mu.Unlock()
+	if !ok {
+		return errors.New(fmt.Sprintf("端口转发会话:%s不存在或已过期", id))
+	}
+	session.stop()
+	return nil
+}
+
+// Exists 判断会话是否存在
+func (p *portForward) Exists(id string) bool {
+	_, err := p.get(id)
+	return err == nil
+}
+
+func (p *portForward) get(id string) (*forwardSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	session, ok := p.sessions[id]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("端口转发会话:%s不存在或已过期", id))
+	}
+	return session, nil
+}
+
+// TunnelConn websocket 隧道使用的连接，*websocket.Conn 满足该接口
+type TunnelConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// Tunnel 将 websocket 连接与 pod 端口的一条 TCP 连接双向转发，直到任一端关闭或会话结束
+// 客户端发送和接收的都是二进制消息
+func (p *portForward) Tunnel(id string, conn TunnelConn) error {
+	session, err := p.get(id)
+	if err != nil {
+		return err
+	}
+	tcpConn, err := net.Dial("tcp", session.localAddr)
+	if err != nil {
+		logger.Error(fmt.Sprintf("连接端口转发失败, %v", err))
+		return errors.New(fmt.Sprintf("连接端口转发失败, %v", err))
+	}
+	closeAll := func() {
+		_ = tcpConn.Close()
+		_ = conn.Close()
+	}
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		closeAll()
+	}()
+	// 会话到期或被删除时断开隧道，隧道正常结束时退出
+	go func() {
+		select {
+		case <-session.stopCh:
+			closeAll()
+		case <-done:
+		}
+	}()
+
+	errCh := make(chan error, 2)
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if _, err := tcpConn.Write(data); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := tcpConn.Read(buf)
+			if n > 0 {
+				if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+					errCh <- err
+					return
+				}
+			}
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	<-errCh
+	return nil
+}
+
+// Proxy 将 http 请求代理到 pod 端口，path 为转发到 pod 的请求路径
+func (p *portForward) Proxy(id, path string, w http.ResponseWriter, r *http.Request) error {
+	session, err := p.get(id)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimSuffix(r.URL.Path, path)
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = session.localAddr
+			req.URL.Path = "/" + strings.TrimPrefix(path, "/")
+			req.URL.RawPath = ""
+			req.Host = session.localAddr
+			// 告知 pod 中的服务外部访问的路径前缀，便于生成正确的链接
+			req.Header.Set("X-Forwarded-Prefix", prefix)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error(fmt.Sprintf("代理端口转发请求失败, %v", err))
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+	return nil
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"kubeadm-platform/config"
+)
+
+// fakeForward 返回固定的本地地址，stopCh 关闭时结束转发
+func fakeForward(addr string, stopped chan<- struct{}) ForwardStarter {
+	return func(client kubernetes.Interface, conf *rest.Config, namespace, podName string, port int, stopCh <-chan struct{}) (string, <-chan error, error) {
+		done := make(chan error, 1)
+		go func() {
+			<-stopCh
+			done <- nil
+			if stopped != nil {
+				stopped <- struct{}{}
+			}
+		}()
+		return addr, done, nil
+	}
+}
+
+func newRunningPodClient() *fake.Clientset {
+	pod := newTestPod("app-1", "default", time.Hour)
+	pod.Status.Phase = corev1.PodRunning
+	pending := newTestPod("app-2", "default", time.Hour)
+	pending.Status.Phase = corev1.PodPending
+	return fake.NewSimpleClientset(pod, pending)
+}
+
+func TestPortForwardCreate(t *testing.T) {
+	client := newRunningPodClient()
+	defer Cache.Evict(client)
+	p := &portForward{StartForward: fakeForward("127.0.0.1:1", nil)}
+
+	tests := []struct {
+		name    string
+		podName string
+		port    int
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{name: "正常创建", podName: "app-1", port: 8080},
+		{name: "端口不合法", podName: "app-1", port: 70000, wantErr: true},
+		{name: "有效期超过上限", podName: "app-1", port: 8080, ttl: 24 * time.Hour, wantErr: true},
+		{name: "pod未运行", podName: "app-2", port: 8080, wantErr: true},
+		{name: "pod不存在", podName: "missing", port: 8080, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := p.Create(client, nil, "test", "default", tt.podName, tt.port, tt.ttl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if session.ID == "" || !session.ExpiresAt.After(session.CreatedAt) {
+					t.Errorf("Create() = %+v", session)
+				}
+				_ = p.Delete(session.ID)
+			}
+		})
+	}
+}
+
+func TestPortForwardCreateMaxSessions(t *testing.T) {
+	client := newRunningPodClient()
+	defer Cache.Evict(client)
+	// 转发建立前阻塞，使所有请求都在会话写入前完成上限检查
+	release := make(chan struct{})
+	forward := fakeForward("127.0.0.1:1", nil)
+	p := &portForward{StartForward: func(client kubernetes.Interface, conf *rest.Config, namespace, podName string, port int, stopCh <-chan struct{}) (string, <-chan error, error) {
+		<-release
+		return forward(client, conf, namespace, podName, port, stopCh)
+	}}
+
+	total := config.PortForwardMaxSessions + 10
+	results := make(chan error, total)
+	for i := 0; i < total; i++ {
+		go func() {
+			_, err := p.Create(client, nil, "test", "default", "app-1", 8080, 0)
+			results <- err
+		}()
+	}
+	failed := 0
+	timeout := time.After(time.Second)
+	for failed < total-config.PortForwardMaxSessions {
+		select {
+		case err := <-results:
+			if err == nil {
+				t.Fatal("转发建立前不应有请求成功")
+			}
+			failed++
+		case <-timeout:
+			t.Fatalf("超过上限的请求数 = %d, want %d", failed, total-config.PortForwardMaxSessions)
+		}
+	}
+	close(release)
+	for i := 0; i < config.PortForwardMaxSessions; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("Create() error = %v", err)
+		}
+	}
+	sessions := p.List()
+	if len(sessions) != config.PortForwardMaxSessions {
+		t.Errorf("会话数 = %d, want %d", len(sessions), config.PortForwardMaxSessions)
+	}
+	for _, session := range sessions {
+		_ = p.Delete(session.ID)
+	}
+	// 会话删除后名额释放
+	session, err := p.Create(client, nil, "test", "default", "app-1", 8080, 0)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	_ = p.Delete(session.ID)
+}
+
+func TestPortForwardCreateReadyTimeout(t *testing.T) {
+	client := newRunningPodClient()
+	defer Cache.Evict(client)
+	// 模拟等待就绪超时后转发才建立，转发一直运行到 stopCh 关闭
+	stopped := make(chan struct{})
+	p := &portForward{StartForward: func(client kubernetes.Interface, conf *rest.Config, namespace, podName string, port int, stopCh <-chan struct{}) (string, <-chan error, error) {
+		time.Sleep(50 * time.Millisecond)
+		go func() {
+			<-stopCh
+			close(stopped)
+		}()
+		return "", nil, errors.New("建立端口转发超时")
+	}}
+
+	if _, err := p.Create(client, nil, "test", "default", "app-1", 8080, 0); err == nil {
+		t.Fatal("Create() 应返回错误")
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("建立转发失败后未关闭 stopCh")
+	}
+	if len(p.List()) != 0 || p.pending != 0 {
+		t.Errorf("建立转发失败后仍占用会话名额, pending = %d", p.pending)
+	}
+}
+
+func TestPortForwardExpire(t *testing.T) {
+	client := newRunningPodClient()
+	defer Cache.Evict(client)
+	stopped := make(chan struct{}, 2)
+	p := &portForward{StartForward: fakeForward("127.0.0.1:1", stopped)}
+
+	// 手动删除
+	session, err := p.Create(client, nil, "test", "default", "app-1", 8080, 0)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(p.List()) != 1 {
+		t.Fatalf("List() = %v", p.List())
+	}
+	if err := p.Delete(session.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	<-stopped
+	if err := p.Delete(session.ID); err == nil {
+		t.Errorf("重复 Delete() 应返回错误")
+	}
+
+	// 到期后自动关闭
+	if _, err := p.Create(client, nil, "test", "default", "app-1", 8080, 50*time.Millisecond); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("会话到期后未关闭转发")
+	}
+	if len(p.List()) != 0 {
+		t.Errorf("到期后 List() = %v", p.List())
+	}
+}
+
+func TestPortForwardProxy(t *testing.T) {
+	var gotPath, gotPrefix string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotPrefix = r.URL.Path, r.Header.Get("X-Forwarded-Prefix")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := newRunningPodClient()
+	defer Cache.Evict(client)
+	p := &portForward{StartForward: fakeForward(strings.TrimPrefix(server.URL, "http://"), nil)}
+	session, err := p.Create(client, nil, "test", "default", "app-1", 80, 0)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer p.Delete(session.ID)
+
+	prefix := "/api/k8s/pod/portforward/proxy/" + session.ID
+	req := httptest.NewRequest(http.MethodGet, prefix+"/metrics", nil)
+	rec := httptest.NewRecorder()
+	if err := p.Proxy(session.ID, "/metrics", rec, req); err != nil {
+		t.Fatalf("Proxy() error = %v", err)
+	}
+	if rec.Body.String() != "ok" || gotPath != "/metrics" || gotPrefix != prefix {
+		t.Errorf("Proxy() body = %q, path = %s, prefix = %s", rec.Body.String(), gotPath, gotPrefix)
+	}
+	if err := p.Proxy("missing", "/", rec, req); err == nil {
+		t.Errorf("Proxy() 会话不存在时应返回错误")
+	}
+}
+
+// fakeTunnelConn 模拟 websocket 连接，in 中的消息依次被读取，写入的消息发送到 out
+type fakeTunnelConn struct {
+	in     chan []byte
+	out    chan []byte
+	closed chan struct{}
+}
+
+func (c *fakeTunnelConn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-c.in:
+		return 2, data, nil
+	case <-c.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+func (c *fakeTunnelConn) WriteMessage(messageType int, data []byte) error {
+	c.out <- append([]byte(nil), data...)
+	return nil
+}
+
+func (c *fakeTunnelConn) Close() error {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	return nil
+}
+
+func TestPortForwardTunnel(t *testing.T) {
+	// echo 服务
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	client := newRunningPodClient()
+	defer Cache.Evict(client)
+	p := &portForward{StartForward: fakeForward(listener.Addr().String(), nil)}
+	session, err := p.Create(client, nil, "test", "default", "app-1", 6379, 0)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	conn := &fakeTunnelConn{in: make(chan []byte, 1), out: make(chan []byte, 1), closed: make(chan struct{})}
+	finished := make(chan error, 1)
+	go func() { finished <- p.Tunnel(session.ID, conn) }()
+	conn.in <- []byte("PING")
+	select {
+	case data := <-conn.out:
+		if string(data) != "PING" {
+			t.Errorf("隧道返回 = %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("隧道未返回数据")
+	}
+
+	// 删除会话后隧道断开
+	_ = p.Delete(session.ID)
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Errorf("Tunnel() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("删除会话后隧道未断开")
+	}
+}
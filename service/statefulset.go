@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wonderivan/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var StatefulSet statefulSet
+
+type statefulSet struct{}
+
+// RestartStatefulSet 重启 StatefulSet，按 updateStrategy 逐个重建 pod
+// updateStrategy 为 OnDelete 时只更新模板，pod 需手动删除后才会重建
+func (s *statefulSet) RestartStatefulSet(client kubernetes.Interface, statefulSetName, namespace string) (err error) {
+	patchByte, err := restartPatch()
+	if err != nil {
+		logger.Error(fmt.Sprintf("序列化失败, %v", err))
+		return errors.New(fmt.Sprintf("序列化失败, %v", err))
+	}
+	_, err = client.AppsV1().StatefulSets(namespace).Patch(context.TODO(), statefulSetName,
+		"application/strategic-merge-patch+json", patchByte, metav1.PatchOptions{})
+	if err != nil {
+		logger.Error(fmt.Sprintf("重启StatefulSet失败, %v", err))
+		return errors.New(fmt.Sprintf("重启StatefulSet失败, %v", err))
+	}
+	return nil
+}
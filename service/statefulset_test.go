@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRestartStatefulSet(t *testing.T) {
+	client := fake.NewSimpleClientset(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "default"},
+	})
+	if err := StatefulSet.RestartStatefulSet(client, "mysql", "default"); err != nil {
+		t.Fatalf("RestartStatefulSet() error = %v", err)
+	}
+	sts, err := client.AppsV1().StatefulSets("default").Get(context.TODO(), "mysql", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(time.RFC3339, sts.Spec.Template.Annotations[restartedAtAnnotation]); err != nil {
+		t.Errorf("pod 模板未设置 %s 注解, annotations = %v", restartedAtAnnotation, sts.Spec.Template.Annotations)
+	}
+	if err := StatefulSet.RestartStatefulSet(client, "missing", "default"); err == nil {
+		t.Errorf("RestartStatefulSet() statefulset 不存在时应返回错误")
+	}
+}
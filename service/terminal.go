@@ -0,0 +1,442 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wonderivan/logger"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"kubeadm-platform/config"
+)
+
+// Terminal 提供容器的交互式 exec 会话
+var Terminal = terminal{
+	NewExecutor: newSPDYExecutor,
+	IdleTimeout: config.ExecIdleTimeout,
+	RecordDir:   config.ExecRecordDir,
+}
+
+// ExecutorFactory 创建远程执行器，测试时可替换为不依赖 apiserver 的实现
+type ExecutorFactory func(client kubernetes.Interface, conf *rest.Config, opts *ExecOptions) (remotecommand.Executor, error)
+
+type terminal struct {
+	// 创建远程执行器的工厂方法
+	NewExecutor ExecutorFactory
+	// 超过该时间没有收到客户端消息则断开会话
+	IdleTimeout time.Duration
+	// 会话录像目录，为空时不录像
+	RecordDir string
+}
+
+// 终端消息类型
+const (
+	TerminalOpStdin  = "stdin"
+	TerminalOpStdout = "stdout"
+	TerminalOpStderr = "stderr"
+	TerminalOpResize = "resize"
+	TerminalOpExit   = "exit"
+)
+
+// defaultShell 未指定命令时启动的交互式 shell，优先使用 bash
+var defaultShell = []string{"/bin/sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"}
+
+// ExecOptions 定义 exec 会话的参数
+type ExecOptions struct {
+	Cluster       string
+	Namespace     string
+	PodName       string
+	ContainerName string
+	// Command 为空时启动交互式 shell 并分配 TTY
+	Command []string
+	TTY     bool
+	// Stdin 是否打开标准输入，交互式会话总是打开
+	Stdin bool
+	// Attach 为 true 时 attach 到容器的主进程而不是执行新命令，忽略 Command
+	// TTY 需与容器定义一致，如临时调试容器需指定 TTY
+	Attach bool
+	// Cols、Rows 终端的初始大小，为 0 时使用 80x24
+	Cols uint16
+	Rows uint16
+}
+
+// TerminalMessage 定义 websocket 上收发的消息
+// 客户端发送 stdin、resize，服务端发送 stdout、stderr，会话结束时发送 exit，Data 为结束原因
+type TerminalMessage struct {
+	Op   string `json:"op"`
+	Data string `json:"data,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
+
+// TerminalConn 会话使用的消息连接，*websocket.Conn 满足该接口
+type TerminalConn interface {
+	ReadJSON(v interface{}) error
+	WriteJSON(v interface{}) error
+	Close() error
+}
+
+// newSPDYExecutor 默认的执行器工厂，通过 pods/exec 或 pods/attach 子资源建立 SPDY 连接
+func newSPDYExecutor(client kubernetes.Interface, conf *rest.Config, opts *ExecOptions) (remotecommand.Executor, error) {
+	if opts.Attach {
+		req := client.CoreV1().RESTClient().Post().
+			Resource("pods").
+			Name(opts.PodName).
+			Namespace(opts.Namespace).
+			SubResource("attach").
+			VersionedParams(&corev1.PodAttachOptions{
+				Container: opts.ContainerName,
+				Stdin:     opts.Stdin,
+				Stdout:    true,
+				Stderr:    !opts.TTY,
+				TTY:       opts.TTY,
+			}, scheme.ParameterCodec)
+		return remotecommand.NewSPDYExecutor(conf, "POST", req.URL())
+	}
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(opts.PodName).
+		Namespace(opts.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: opts.ContainerName,
+			Command:   opts.Command,
+			Stdin:     opts.Stdin,
+			Stdout:    true,
+			Stderr:    !opts.TTY,
+			TTY:       opts.TTY,
+		}, scheme.ParameterCodec)
+	return remotecommand.NewSPDYExecutor(conf, "POST", req.URL())
+}
+
+// Validate 校验并补全 exec 参数
+// pod 必须处于 Running 状态，未指定容器时只允许单容器的 pod，未指定命令时启动 shell，attach 时忽略命令
+func (t *terminal) Validate(client kubernetes.Interface, opts *ExecOptions) error {
+	containerName, err := resolveContainer(client, opts.Namespace, opts.PodName, opts.ContainerName)
+	if err != nil {
+		return err
+	}
+	opts.ContainerName = containerName
+	if opts.Attach {
+		opts.Command = nil
+	} else if len(opts.Command) == 0 {
+		opts.Command = defaultShell
+		opts.TTY = true
+	}
+	if opts.Cols == 0 || opts.Rows == 0 {
+		opts.Cols, opts.Rows = 80, 24
+	}
+	return nil
+}
+
+// resolveContainer 校验 pod 处于 Running 状态并返回要执行命令的容器
+// 未指定容器时只允许单容器的 pod
+func resolveContainer(client kubernetes.Interface, namespace, podName, containerName string) (string, error) {
+	pod, _, err := Pod.GetPodDetail(client, podName, namespace, true)
+	if err != nil {
+		return "", err
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return "", errors.New(fmt.Sprintf("Pod:%s当前状态为%s，无法执行命令", podName, pod.Status.Phase))
+	}
+	if containerName == "" {
+		if len(pod.Spec.Containers) != 1 {
+			return "", errors.New(fmt.Sprintf("Pod:%s有多个容器，请指定容器", podName))
+		}
+		return pod.Spec.Containers[0].Name, nil
+	}
+	if containsContainer(pod.Spec.Containers, containerName) {
+		return containerName, nil
+	}
+	// 临时调试容器同样可以执行命令
+	for _, container := range pod.Spec.EphemeralContainers {
+		if container.Name == containerName {
+			return containerName, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("容器:%s在Pod:%s中不存在", containerName, podName))
+}
+
+// Run 在容器中执行命令，通过 conn 转发输入输出，直到命令退出、客户端断开或会话空闲超时
+// 调用前需先通过 Validate 校验参数
+func (t *terminal) Run(client kubernetes.Interface, conf *rest.Config, conn TerminalConn, opts *ExecOptions) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &terminalSession{
+		conn:   conn,
+		sizeCh: make(chan remotecommand.TerminalSize, 1),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	defer session.close()
+	// 初始终端大小
+	session.sizeCh <- remotecommand.TerminalSize{Width: opts.Cols, Height: opts.Rows}
+
+	if t.RecordDir != "" {
+		recorder, err := newSessionRecorder(t.RecordDir, opts)
+		if err != nil {
+			// 录像失败不影响会话
+			logger.Error(fmt.Sprintf("创建exec会话录像失败, %v", err))
+		}
+		session.recorder = recorder
+	}
+	if t.IdleTimeout > 0 {
+		session.idleTimeout = t.IdleTimeout
+		// 超时后断开连接并取消命令，由 Run 返回时统一释放会话
+		session.idle = time.AfterFunc(t.IdleTimeout, func() {
+			session.exit("会话空闲超时")
+			cancel()
+			_ = conn.Close()
+		})
+	}
+
+	opts.Stdin = true
+	executor, err := t.NewExecutor(client, conf, opts)
+	if err != nil {
+		logger.Error(fmt.Sprintf("创建exec连接失败, %v", err))
+		err = errors.New(fmt.Sprintf("创建exec连接失败, %v", err))
+		session.exit(err.Error())
+		return err
+	}
+	streamOptions := remotecommand.StreamOptions{
+		Stdin:  session,
+		Stdout: session,
+		Tty:    opts.TTY,
+	}
+	if opts.TTY {
+		streamOptions.TerminalSizeQueue = session
+	} else {
+		streamOptions.Stderr = stderrWriter{session}
+	}
+	err = executor.StreamWithContext(ctx, streamOptions)
+	if err != nil && ctx.Err() == nil {
+		logger.Error(fmt.Sprintf("执行命令失败, %v", err))
+		err = errors.New(fmt.Sprintf("执行命令失败, %v", err))
+		session.exit(err.Error())
+		return err
+	}
+	session.exit("会话结束")
+	return nil
+}
+
+// terminalSession 将 websocket 消息适配为 remotecommand 的输入输出和终端大小队列
+type terminalSession struct {
+	conn     TerminalConn
+	sizeCh   chan remotecommand.TerminalSize
+	recorder *sessionRecorder
+	idle     *time.Timer
+	// 空闲超时时间，每次收到客户端消息后重新计时
+	idleTimeout time.Duration
+	cancel      context.CancelFunc
+
+	// 尚未被读取的输入
+	pending []byte
+	// 每种输出上次末尾不完整的 UTF-8 字符，与下次输出一起发送
+	partial map[string][]byte
+	// 保护 conn 的并发写和 partial
+	writeMu   sync.Mutex
+	exitOnce  sync.Once
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Read 读取客户端的输入，处理期间收到的 resize 消息
+func (s *terminalSession) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		var msg TerminalMessage
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			// 客户端断开，结束命令
+			s.cancel()
+			return 0, io.EOF
+		}
+		if s.idle != nil {
+			s.idle.Reset(s.idleTimeout)
+		}
+		switch msg.Op {
+		case TerminalOpStdin:
+			s.recorder.record("i", msg.Data)
+			s.pending = []byte(msg.Data)
+		case TerminalOpResize:
+			if msg.Cols == 0 || msg.Rows == 0 {
+				continue
+			}
+			s.recorder.record("r", fmt.Sprintf("%dx%d", msg.Cols, msg.Rows))
+			s.resize(remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows})
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// resize 只保留最新的终端大小
+func (s *terminalSession) resize(size remotecommand.TerminalSize) {
+	for {
+		select {
+		case s.sizeCh <- size:
+			return
+		default:
+		}
+		select {
+		case <-s.sizeCh:
+		default:
+		}
+	}
+}
+
+// Next 实现 remotecommand.TerminalSizeQueue，会话关闭后返回 nil
+func (s *terminalSession) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-s.sizeCh:
+		return &size
+	case <-s.done:
+		return nil
+	}
+}
+
+// Write 将标准输出发送给客户端
+func (s *terminalSession) Write(p []byte) (int, error) {
+	return s.send(TerminalOpStdout, p)
+}
+
+// send 发送输出，多字节字符被拆分到两次输出时，不完整的部分留到下次发送，避免 json 编码时变成 U+FFFD
+func (s *terminalSession) send(op string, p []byte) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.partial == nil {
+		s.partial = make(map[string][]byte)
+	}
+	data := append(s.partial[op], p...)
+	n := len(data) - incompleteRuneLen(data)
+	s.partial[op] = append([]byte(nil), data[n:]...)
+	if n == 0 {
+		return len(p), nil
+	}
+	s.recorder.record("o", string(data[:n]))
+	if err := s.conn.WriteJSON(TerminalMessage{Op: op, Data: string(data[:n])}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// incompleteRuneLen 返回 p 末尾不完整的 UTF-8 字符的字节数
+func incompleteRuneLen(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if utf8.FullRune(p[i:]) {
+				return 0
+			}
+			return len(p) - i
+		}
+	}
+	return 0
+}
+
+// exit 通知客户端会话结束，只发送一次，先发送剩余的不完整输出
+func (s *terminalSession) exit(reason string) {
+	s.exitOnce.Do(func() {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+		for _, op := range []string{TerminalOpStdout, TerminalOpStderr} {
+			if len(s.partial[op]) > 0 {
+				s.recorder.record("o", string(s.partial[op]))
+				_ = s.conn.WriteJSON(TerminalMessage{Op: op, Data: string(s.partial[op])})
+				delete(s.partial, op)
+			}
+		}
+		_ = s.conn.WriteJSON(TerminalMessage{Op: TerminalOpExit, Data: reason})
+	})
+}
+
+func (s *terminalSession) close() {
+	s.closeOnce.Do(func() {
+		if s.idle != nil {
+			s.idle.Stop()
+		}
+		s.cancel()
+		close(s.done)
+		_ = s.conn.Close()
+		s.recorder.close()
+	})
+}
+
+// stderrWriter 将标准错误发送给客户端，非 TTY 模式下使用
+type stderrWriter struct {
+	session *terminalSession
+}
+
+func (w stderrWriter) Write(p []byte) (int, error) {
+	return w.session.send(TerminalOpStderr, p)
+}
+
+// sessionRecorder 以 asciinema v2 格式记录会话，可用 asciinema play 回放
+// 记录输出(o)、输入(i)和终端大小变化(r)，nil 时不记录
+type sessionRecorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	start time.Time
+}
+
+func newSessionRecorder(dir string, opts *ExecOptions) (*sessionRecorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	name := fmt.Sprintf("%s_%s_%s_%s_%s.cast", opts.Cluster, opts.Namespace, opts.PodName, opts.ContainerName,
+		start.Format("20060102-150405.000"))
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	header, err := json.Marshal(map[string]interface{}{
+		"version":   2,
+		"width":     opts.Cols,
+		"height":    opts.Rows,
+		"timestamp": start.Unix(),
+		"title":     strings.Join(opts.Command, " "),
+	})
+	if err == nil {
+		_, err = file.Write(append(header, '\n'))
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &sessionRecorder{file: file, start: start}, nil
+}
+
+func (r *sessionRecorder) record(kind, data string) {
+	if r == nil {
+		return
+	}
+	event, err := json.Marshal([]interface{}{time.Since(r.start).Seconds(), kind, data})
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Write(append(event, '\n')); err != nil {
+		logger.Error(fmt.Sprintf("写入exec会话录像失败, %v", err))
+	}
+}
+
+func (r *sessionRecorder) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.file.Close()
+}
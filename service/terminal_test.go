@@ -0,0 +1,263 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// fakeTerminalConn 模拟 websocket 连接，in 为客户端发送的消息，out 记录服务端发送的消息
+type fakeTerminalConn struct {
+	in     chan TerminalMessage
+	mu     sync.Mutex
+	out    []TerminalMessage
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newFakeTerminalConn(messages ...TerminalMessage) *fakeTerminalConn {
+	c := &fakeTerminalConn{in: make(chan TerminalMessage, len(messages)), closed: make(chan struct{})}
+	for _, msg := range messages {
+		c.in <- msg
+	}
+	return c
+}
+
+func (c *fakeTerminalConn) ReadJSON(v interface{}) error {
+	select {
+	case msg := <-c.in:
+		*v.(*TerminalMessage) = msg
+		return nil
+	case <-c.closed:
+		return errors.New("connection closed")
+	}
+}
+
+func (c *fakeTerminalConn) WriteJSON(v interface{}) error {
+	select {
+	case <-c.closed:
+		return errors.New("connection closed")
+	default:
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.out = append(c.out, v.(TerminalMessage))
+	return nil
+}
+
+func (c *fakeTerminalConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *fakeTerminalConn) messages() []TerminalMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]TerminalMessage(nil), c.out...)
+}
+
+// fakeExecutor 以函数模拟远程执行
+type fakeExecutor func(ctx context.Context, options remotecommand.StreamOptions) error
+
+func (f fakeExecutor) Stream(options remotecommand.StreamOptions) error {
+	return f(context.Background(), options)
+}
+
+func (f fakeExecutor) StreamWithContext(ctx context.Context, options remotecommand.StreamOptions) error {
+	return f(ctx, options)
+}
+
+func executorFactory(f fakeExecutor) ExecutorFactory {
+	return func(client kubernetes.Interface, conf *rest.Config, opts *ExecOptions) (remotecommand.Executor, error) {
+		return f, nil
+	}
+}
+
+func TestTerminalValidate(t *testing.T) {
+	newPod := func(name string, phase corev1.PodPhase, containers ...string) *corev1.Pod {
+		pod := newTestPod(name, "default", time.Hour)
+		for _, container := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+		}
+		pod.Status.Phase = phase
+		return pod
+	}
+	client := fake.NewSimpleClientset(
+		newPod("single", corev1.PodRunning, "app"),
+		newPod("multi", corev1.PodRunning, "app", "sidecar"),
+		newPod("pending", corev1.PodPending, "app"),
+	)
+	defer Cache.Evict(client)
+	debug := newPod("debug", corev1.PodRunning, "app")
+	debug.Spec.EphemeralContainers = []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger"}}}
+	if err := client.Tracker().Add(debug); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		opts          ExecOptions
+		wantContainer string
+		wantErr       bool
+	}{
+		{name: "单容器 pod 未指定容器时使用唯一容器", opts: ExecOptions{PodName: "single"}, wantContainer: "app"},
+		{name: "多容器 pod 指定容器", opts: ExecOptions{PodName: "multi", ContainerName: "sidecar"}, wantContainer: "sidecar"},
+		{name: "多容器 pod 未指定容器", opts: ExecOptions{PodName: "multi"}, wantErr: true},
+		{name: "容器不存在", opts: ExecOptions{PodName: "single", ContainerName: "missing"}, wantErr: true},
+		{name: "临时调试容器", opts: ExecOptions{PodName: "debug", ContainerName: "debugger"}, wantContainer: "debugger"},
+		{name: "pod 未运行", opts: ExecOptions{PodName: "pending"}, wantErr: true},
+		{name: "pod 不存在", opts: ExecOptions{PodName: "missing"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Namespace = "default"
+			err := Terminal.Validate(client, &opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if opts.ContainerName != tt.wantContainer {
+				t.Errorf("Validate() container = %s, want %s", opts.ContainerName, tt.wantContainer)
+			}
+			if !opts.TTY || len(opts.Command) == 0 || opts.Cols != 80 || opts.Rows != 24 {
+				t.Errorf("Validate() 未指定命令时应打开 shell, got %+v", opts)
+			}
+		})
+	}
+}
+
+func TestTerminalRun(t *testing.T) {
+	dir := t.TempDir()
+	// 回显一次输入并读取终端大小
+	echo := fakeExecutor(func(ctx context.Context, options remotecommand.StreamOptions) error {
+		size := options.TerminalSizeQueue.Next()
+		if size == nil || size.Width != 80 {
+			return errors.New("未收到初始终端大小")
+		}
+		line, err := bufio.NewReader(options.Stdin).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if size = options.TerminalSizeQueue.Next(); size == nil || size.Width != 120 {
+			return errors.New("未收到 resize")
+		}
+		_, err = options.Stdout.Write([]byte("echo:" + line))
+		return err
+	})
+	term := &terminal{NewExecutor: executorFactory(echo), IdleTimeout: time.Minute, RecordDir: dir}
+	conn := newFakeTerminalConn(
+		TerminalMessage{Op: TerminalOpStdin, Data: "ls"},
+		TerminalMessage{Op: TerminalOpResize, Cols: 120, Rows: 40},
+		TerminalMessage{Op: TerminalOpStdin, Data: "\n"},
+	)
+	opts := &ExecOptions{Cluster: "TST-1", Namespace: "default", PodName: "nginx", ContainerName: "app",
+		Command: defaultShell, TTY: true, Cols: 80, Rows: 24}
+	if err := term.Run(nil, nil, conn, opts); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got := conn.messages()
+	want := []TerminalMessage{{Op: TerminalOpStdout, Data: "echo:ls\n"}, {Op: TerminalOpExit, Data: "会话结束"}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Run() 发送的消息 = %+v, want %+v", got, want)
+	}
+
+	// 录像文件为 asciinema v2 格式，首行为 header，之后每行一个事件
+	files, _ := filepath.Glob(filepath.Join(dir, "TST-1_default_nginx_app_*.cast"))
+	if len(files) != 1 {
+		t.Fatalf("录像文件数量 = %d, want 1", len(files))
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	var header map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header["version"] != float64(2) {
+		t.Errorf("录像 header = %s", lines[0])
+	}
+	var kinds []string
+	for _, line := range lines[1:] {
+		var event []interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil || len(event) != 3 {
+			t.Fatalf("录像事件格式错误: %s", line)
+		}
+		kinds = append(kinds, event[1].(string))
+	}
+	if strings.Join(kinds, ",") != "i,r,i,o" {
+		t.Errorf("录像事件类型 = %v, want [i r i o]", kinds)
+	}
+}
+
+func TestTerminalRunSplitRune(t *testing.T) {
+	// 多字节字符被拆分到两次输出中，最后一次输出以不完整的字符结束
+	text := []byte("中文")
+	split := fakeExecutor(func(ctx context.Context, options remotecommand.StreamOptions) error {
+		for _, chunk := range [][]byte{[]byte("a"), text[:2], text[2:4], text[4:], text[:1]} {
+			if _, err := options.Stdout.Write(chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	term := &terminal{NewExecutor: executorFactory(split), IdleTimeout: time.Minute}
+	conn := newFakeTerminalConn()
+	opts := &ExecOptions{Namespace: "default", PodName: "nginx", ContainerName: "app", Command: defaultShell, TTY: true}
+	if err := term.Run(nil, nil, conn, opts); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var got []string
+	for _, msg := range conn.messages() {
+		got = append(got, msg.Op+":"+msg.Data)
+	}
+	want := []string{"stdout:a", "stdout:中", "stdout:文", "stdout:" + string(text[:1]), "exit:会话结束"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Run() 发送的消息 = %q, want %q", got, want)
+	}
+}
+
+func TestTerminalRunIdleTimeout(t *testing.T) {
+	// 命令一直运行直到会话被取消
+	block := fakeExecutor(func(ctx context.Context, options remotecommand.StreamOptions) error {
+		go func() { _, _ = options.Stdin.Read(make([]byte, 1)) }()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	term := &terminal{NewExecutor: executorFactory(block), IdleTimeout: 50 * time.Millisecond}
+	conn := newFakeTerminalConn()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- term.Run(nil, nil, conn, &ExecOptions{Command: []string{"sleep", "infinity"}})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("空闲超时后会话未结束")
+	}
+	got := conn.messages()
+	if len(got) != 1 || got[0].Op != TerminalOpExit || got[0].Data != "会话空闲超时" {
+		t.Errorf("Run() 发送的消息 = %+v", got)
+	}
+}